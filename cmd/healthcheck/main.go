@@ -2,31 +2,132 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/OpenSlides/openslides-manage-service/pkg/backendaction"
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/datastorereader"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
 	"github.com/OpenSlides/openslides-manage-service/pkg/server"
 	"github.com/OpenSlides/openslides-manage-service/proto"
-	"google.golang.org/grpc/status"
 )
 
 const (
-	timeout = 1 * time.Second
+	defaultTimeout = 1 * time.Second
 )
 
-func healthcheck() error {
+// Exit codes of the healthcheck. In deep mode the code of the first failed
+// check is used. The code 2 is reserved by Docker. Invalid environment
+// variables are reported with the general code 1.
+const (
+	exitInvalidUsage = 1
+	exitSecrets      = 3
+	exitBackend      = 4
+	exitDatastore    = 5
+	exitManage       = 6
+)
+
+// check is one step of the healthcheck.
+type check struct {
+	name     string
+	exitCode int
+	run      func(context.Context, *server.Config) error
+}
+
+// checkResult is the result of one check in the JSON summary.
+type checkResult struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	ExitCode   int    `json:"exit_code,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// summary is printed to stdout in deep mode.
+type summary struct {
+	Healthy  bool          `json:"healthy"`
+	ExitCode int           `json:"exit_code"`
+	Checks   []checkResult `json:"checks"`
+}
+
+func checks(deep bool) []check {
+	c := []check{{name: "manage", exitCode: exitManage, run: checkManage}}
+	if deep {
+		c = append(c,
+			check{name: "secrets", exitCode: exitSecrets, run: checkSecrets},
+			check{name: "backend", exitCode: exitBackend, run: checkBackend},
+			check{name: "datastore", exitCode: exitDatastore, run: checkDatastore},
+		)
+	}
+	return c
+}
+
+// healthcheck runs all checks and returns the exit code.
+func healthcheck(deep bool, timeout time.Duration) int {
 	cfg := server.ConfigFromEnv(os.LookupEnv)
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	s := summary{Healthy: true}
+	for _, c := range checks(deep) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		err := c.run(ctx, cfg)
+		cancel()
+
+		r := checkResult{Name: c.name, OK: err == nil, DurationMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			r.Error = err.Error()
+			r.ExitCode = c.exitCode
+			if s.Healthy {
+				s.Healthy = false
+				s.ExitCode = c.exitCode
+			}
+			if !deep {
+				os.Stderr.WriteString(err.Error())
+			}
+		}
+		s.Checks = append(s.Checks, r)
+	}
+
+	if deep {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(s)
+	}
+	return s.ExitCode
+}
+
+// checkManage calls the Health procedure of the local manage server.
+func checkManage(ctx context.Context, cfg *server.Config) error {
+	var tlsConfig *tls.Config
+	if cfg.TLSCertFile != "" {
+		// The healthcheck connects to the local server, so its certificate
+		// does not need to be verified.
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+
+		if cfg.TLSClientCAFile != "" {
+			if cfg.HealthcheckClientCertFile == "" || cfg.HealthcheckClientKeyFile == "" {
+				return fmt.Errorf("the server requires client certificates, set MANAGE_HEALTHCHECK_CLIENT_CERT_FILE and MANAGE_HEALTHCHECK_CLIENT_KEY_FILE")
+			}
+			cert, err := tls.LoadX509KeyPair(cfg.HealthcheckClientCertFile, cfg.HealthcheckClientKeyFile)
+			if err != nil {
+				return fmt.Errorf("loading healthcheck client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
 
 	cl, close, err := connection.Dial(
 		ctx,
-		"localhost:"+cfg.Port,
+		cfg.LocalAddress(),
 		cfg.ManageAuthPasswordFile,
-		false,
+		tlsConfig,
 	)
 	if err != nil {
 		return fmt.Errorf("connecting to gRPC server: %w", err)
@@ -35,8 +136,7 @@ func healthcheck() error {
 
 	resp, err := cl.Health(ctx, &proto.HealthRequest{})
 	if err != nil {
-		s, _ := status.FromError(err) // The ok value does not matter here.
-		return fmt.Errorf("calling manage service: %s", s.Message())
+		return fmt.Errorf("calling manage service: %w", fehler.FromGRPC(err))
 	}
 
 	if !resp.Healthy {
@@ -45,9 +145,75 @@ func healthcheck() error {
 	return nil
 }
 
+// checkSecrets checks that all configured secret files are readable.
+func checkSecrets(ctx context.Context, cfg *server.Config) error {
+	for _, f := range []string{cfg.ManageAuthPasswordFile, cfg.InternalAuthPasswordFile, cfg.SuperadminPasswordFile} {
+		if _, err := secrets.AuthSecret(f, cfg.OpenSlidesDevelopment); err != nil {
+			return err
+		}
+	}
+	for _, f := range []string{cfg.ManageAuthTokensFile, cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile, cfg.HealthcheckClientCertFile, cfg.HealthcheckClientKeyFile} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.ReadFile(f); err != nil {
+			return fmt.Errorf("reading file %q: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// checkBackend calls the health route of the backend.
+func checkBackend(ctx context.Context, cfg *server.Config) error {
+	pw, err := secrets.AuthSecret(cfg.InternalAuthPasswordFile, cfg.OpenSlidesDevelopment)
+	if err != nil {
+		return fmt.Errorf("getting internal auth password from file: %w", err)
+	}
+	a := backendaction.New(cfg.ManageBackendHealthURL(), pw, backendaction.HealthRoute)
+	if _, err := a.Health(ctx); err != nil {
+		return fmt.Errorf("calling backend health route: %w", err)
+	}
+	return nil
+}
+
+// checkDatastore calls the health route of the datastore reader.
+func checkDatastore(ctx context.Context, cfg *server.Config) error {
+	if err := datastorereader.New(cfg.DatastoreReaderURL()).Health(ctx); err != nil {
+		return fmt.Errorf("calling datastore reader health route: %w", err)
+	}
+	return nil
+}
+
+// envBool returns the boolean value of the environment variable or false.
+func envBool(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
+
+// envDuration returns the duration of the environment variable or the given
+// default.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return d, nil
+}
+
 func main() {
-	if err := healthcheck(); err != nil {
+	envTimeout, err := envDuration("MANAGE_HEALTHCHECK_TIMEOUT", defaultTimeout)
+	if err != nil {
 		os.Stderr.WriteString(err.Error())
-		os.Exit(1)
+		os.Exit(exitInvalidUsage)
 	}
+
+	deep := flag.Bool("deep", envBool("MANAGE_HEALTHCHECK_DEEP"), "also check secret files, the backend and the datastore reader and print a JSON summary (env MANAGE_HEALTHCHECK_DEEP)")
+	timeout := flag.Duration("timeout", envTimeout, "timeout for each check (env MANAGE_HEALTHCHECK_TIMEOUT)")
+	flag.Parse()
+
+	os.Exit(healthcheck(*deep, *timeout))
 }
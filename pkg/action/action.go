@@ -4,14 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
 	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/codes"
 )
 
 const (
@@ -46,10 +49,10 @@ func Cmd() *cobra.Command {
 			return fmt.Errorf("reading payload from positional argument or file or stdin: %w", err)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := cp.Dial(ctx)
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -78,11 +81,11 @@ func Run(ctx context.Context, gc gRPCClient, action string, payload []byte) erro
 
 	resp, err := gc.Action(ctx, in)
 	if err != nil {
-		s, _ := status.FromError(err) // The ok value does not matter here.
-		return fmt.Errorf("calling manage service (calling backend action): %s", s.Message())
+		return fmt.Errorf("calling manage service (calling backend action): %w", fehler.FromGRPC(err))
 	}
-	fmt.Printf("Request was successful with following response: %s\n", string(resp.Payload))
-	return nil
+	p := output.FromContext(ctx)
+	p.Printf("Request was successful with following response: %s\n", string(resp.Payload))
+	return p.Result(output.RawJSON(resp.Payload))
 }
 
 // Server
@@ -91,14 +94,56 @@ type backendAction interface {
 	Single(ctx context.Context, name string, data json.RawMessage) (json.RawMessage, error)
 }
 
-// Action calls the given backend action with the given payload.
+// Policy decides which actions may be called via the Action procedure. An
+// action is allowed if it matches at least one allow pattern and no deny
+// pattern. Patterns use the syntax of path.Match, e. g. "*.update" or
+// "organization.*delete*".
+type Policy struct {
+	allow []string
+	deny  []string
+}
+
+// NewPolicy returns a new policy. It returns an error if a pattern is
+// malformed.
+func NewPolicy(allow, deny []string) (Policy, error) {
+	for _, pattern := range append(append([]string{}, allow...), deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Policy{}, fmt.Errorf("invalid action pattern %q: %w", pattern, err)
+		}
+	}
+	return Policy{allow: allow, deny: deny}, nil
+}
+
+// Check returns an error if the given action is not allowed.
+func (p Policy) Check(name string) error {
+	for _, pattern := range p.deny {
+		if ok, _ := path.Match(pattern, name); ok { // Patterns were checked in NewPolicy.
+			return fmt.Errorf("action %q is denied by pattern %q", name, pattern)
+		}
+	}
+	for _, pattern := range p.allow {
+		if ok, _ := path.Match(pattern, name); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("action %q is not allowed", name)
+}
+
+// Action calls the given backend action with the given payload if the policy
+// allows it.
 // This function is the server side entrypoint for this package.
-func Action(ctx context.Context, in *proto.ActionRequest, ba backendAction) (*proto.ActionResponse, error) {
+func Action(ctx context.Context, in *proto.ActionRequest, ba backendAction, policy Policy) (*proto.ActionResponse, error) {
 	name := in.Action
+	if name == "" {
+		return nil, fehler.WithCode(codes.InvalidArgument, fmt.Errorf("missing action name"))
+	}
+	if err := policy.Check(name); err != nil {
+		return nil, fehler.WithCode(codes.PermissionDenied, fmt.Errorf("checking action policy: %w", err))
+	}
 
 	c, err := yaml.YAMLToJSON(in.Payload)
 	if err != nil {
-		return nil, fmt.Errorf("converting YAML to JSON: %w", err)
+		return nil, fehler.WithCode(codes.InvalidArgument, fmt.Errorf("converting YAML to JSON: %w", err))
 	}
 
 	result, err := ba.Single(ctx, name, c)
@@ -2,11 +2,14 @@ package action_test
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/action"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestCmd(t *testing.T) {
@@ -42,4 +45,69 @@ func TestSet(t *testing.T) {
 
 // Server tests
 
-// No tests here because the code does to do anything interesting.
+func TestPolicy(t *testing.T) {
+	p, err := action.NewPolicy([]string{"*.update", "user.create"}, []string{"organization.*delete*"})
+	if err != nil {
+		t.Fatalf("creating policy: %v", err)
+	}
+	for _, tt := range []struct {
+		name    string
+		allowed bool
+	}{
+		{"user.update", true},
+		{"user.create", true},
+		{"organization.update", true},
+		{"user.delete", false},
+		{"organization.delete", false},
+		{"organization.delete_all", false},
+	} {
+		err := p.Check(tt.name)
+		if tt.allowed && err != nil {
+			t.Errorf("action %q should be allowed, got error: %v", tt.name, err)
+		}
+		if !tt.allowed && err == nil {
+			t.Errorf("action %q should be denied but it is allowed", tt.name)
+		}
+	}
+
+	if _, err := action.NewPolicy([]string{"[invalid"}, nil); err == nil {
+		t.Fatalf("creating policy with invalid pattern should fail but it didn't")
+	}
+}
+
+type mockBackendAction struct {
+	called bool
+}
+
+func (m *mockBackendAction) Single(ctx context.Context, name string, data json.RawMessage) (json.RawMessage, error) {
+	m.called = true
+	return []byte(`[{"id": 1}]`), nil
+}
+
+func TestAction(t *testing.T) {
+	p, err := action.NewPolicy([]string{"*"}, []string{"*.delete"})
+	if err != nil {
+		t.Fatalf("creating policy: %v", err)
+	}
+
+	t.Run("allowed action", func(t *testing.T) {
+		ba := new(mockBackendAction)
+		if _, err := action.Action(context.Background(), &proto.ActionRequest{Action: "user.update", Payload: []byte("[]")}, ba, p); err != nil {
+			t.Fatalf("calling action.Action() failed with error: %v", err)
+		}
+		if !ba.called {
+			t.Fatalf("backend was not called")
+		}
+	})
+
+	t.Run("denied action", func(t *testing.T) {
+		ba := new(mockBackendAction)
+		_, err := action.Action(context.Background(), &proto.ActionRequest{Action: "user.delete", Payload: []byte("[]")}, ba, p)
+		if got := status.Code(err); got != codes.PermissionDenied {
+			t.Fatalf("wrong status code, expected %s, got %s", codes.PermissionDenied, got)
+		}
+		if ba.called {
+			t.Fatalf("backend was called for denied action")
+		}
+	})
+}
@@ -0,0 +1,637 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
+
+const (
+	// ApplyHelp contains the short help text for the command.
+	ApplyHelp = "Runs the steps of a YAML or JSON plan file one after another"
+
+	// ApplyHelpExtra contains the long help text for the command without
+	// the headline.
+	ApplyHelpExtra = `This command reads a plan file with ordered steps and runs them one after
+another. A step is either an OpenSlides backend action, a get request to the
+datastore or an assertion. Use - as filename to read the plan from stdin.
+
+Values in a step can reference variables of the plan with ${vars.name} and
+results of earlier steps with ${steps.name.result} followed by a path like
+[0].id. If a string consists only of such a reference, the referenced value
+is inserted with its original type.
+
+The command stops at the first failing step. Steps that were executed before
+are not rolled back.
+
+Example:
+  vars:
+    committee_name: Berlin
+  steps:
+    - name: committee
+      action: committee.create
+      payload:
+        - name: ${vars.committee_name}
+          organization_id: 1
+    - name: meeting
+      action: meeting.create
+      payload:
+        - committee_id: ${steps.committee.result[0].id}
+          name: Annual general meeting
+          admin_ids: [1]
+    - name: lookup
+      get: meeting
+      filter:
+        name: Annual general meeting
+      fields: [id]
+    - assert:
+        value: ${steps.lookup.result}
+        not_empty: true`
+)
+
+// Cmd returns the subcommand.
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply plan",
+		Short: ApplyHelp,
+		Long:  ApplyHelp + "\n\n" + ApplyHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+	cp := connection.Unary(cmd)
+
+	dryRun := cmd.Flags().Bool("dry-run", false, "print the resolved requests without sending them")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		content, err := shared.ReadFromFileOrStdin(args[0])
+		if err != nil {
+			return fmt.Errorf("reading plan file: %w", err)
+		}
+		p, err := ParsePlan(content)
+		if err != nil {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("parsing plan file: %w", err))
+		}
+
+		if *dryRun {
+			if err := Run(cmd.Context(), nil, p, true); err != nil {
+				return fmt.Errorf("running plan in dry-run mode: %w", err)
+			}
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
+		defer cancel()
+
+		cl, close, err := cp.Dial(ctx)
+		if err != nil {
+			return fmt.Errorf("connecting to gRPC server: %w", err)
+		}
+		defer close()
+
+		if err := Run(ctx, cl, p, false); err != nil {
+			return fmt.Errorf("running plan: %w", err)
+		}
+		return nil
+	}
+	return cmd
+}
+
+// Plan
+
+// Plan contains the variables and the ordered steps of a plan file.
+type Plan struct {
+	Vars  map[string]interface{} `json:"vars"`
+	Steps []Step                 `json:"steps"`
+}
+
+// Step is a single step of a plan. Exactly one of Action, Get and Assert has
+// to be set.
+type Step struct {
+	Name string `json:"name"`
+
+	Action  string      `json:"action"`
+	Payload interface{} `json:"payload"`
+
+	Get       string                 `json:"get"`
+	Exists    bool                   `json:"exists"`
+	Filter    map[string]interface{} `json:"filter"`
+	FilterRaw interface{}            `json:"filter_raw"`
+	Fields    []string               `json:"fields"`
+
+	Assert *Assertion `json:"assert"`
+}
+
+// Assertion compares a (usually referenced) value. If Equals is given, the
+// value has to be equal to it. If NotEmpty is true, the value must not be
+// null, false, zero or an empty string, list or object.
+type Assertion struct {
+	Value    interface{} `json:"value"`
+	Equals   interface{} `json:"equals"`
+	NotEmpty bool        `json:"not_empty"`
+	Message  string      `json:"message"`
+}
+
+// ParsePlan parses the given YAML or JSON plan and validates its steps.
+func ParsePlan(content []byte) (*Plan, error) {
+	c, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("converting YAML to JSON: %w", err)
+	}
+	p := new(Plan)
+	if err := json.Unmarshal(c, p); err != nil {
+		return nil, fmt.Errorf("unmarshalling plan: %w", err)
+	}
+	if len(p.Steps) == 0 {
+		return nil, fmt.Errorf("plan does not contain any steps")
+	}
+
+	names := make(map[string]bool)
+	for i, s := range p.Steps {
+		kinds := 0
+		if s.Action != "" {
+			kinds++
+		}
+		if s.Get != "" {
+			kinds++
+		}
+		if s.Assert != nil {
+			kinds++
+		}
+		if kinds != 1 {
+			return nil, fmt.Errorf("step %d must contain exactly one of action, get and assert", i+1)
+		}
+		if s.Name == "" {
+			continue
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("step %d: duplicate step name %q", i+1, s.Name)
+		}
+		names[s.Name] = true
+	}
+	return p, nil
+}
+
+// label returns a human readable identifier of the step with the given index.
+func (s Step) label(i int) string {
+	if s.Name != "" {
+		return fmt.Sprintf("step %d (%s)", i+1, s.Name)
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+// Client
+
+type gRPCClient interface {
+	Action(ctx context.Context, in *proto.ActionRequest, opts ...grpc.CallOption) (*proto.ActionResponse, error)
+	Get(ctx context.Context, in *proto.GetRequest, opts ...grpc.CallOption) (*proto.GetResponse, error)
+}
+
+// Run executes the steps of the given plan via given gRPC client. In dry-run
+// mode the resolved requests are printed but not sent and the client may be
+// nil. References to results of earlier steps can not be resolved in this mode
+// and are printed unchanged.
+//
+// If the plan fails after some actions were already applied, the error has the
+// exit code for partial success.
+func Run(ctx context.Context, gc gRPCClient, p *Plan, dryRun bool) (err error) {
+	applied := 0
+	defer func() {
+		if err != nil && applied > 0 {
+			err = fehler.ExitCode(fehler.ExitPartialSuccess, fmt.Errorf("%d actions were applied before: %w", applied, err))
+		}
+	}()
+
+	r := resolver{
+		vars:    p.Vars,
+		results: make(map[string]interface{}),
+		lenient: dryRun,
+	}
+
+	out := output.FromContext(ctx)
+	result := planResult{DryRun: dryRun}
+
+	for i, step := range p.Steps {
+		sr := stepResult{Step: step.label(i)}
+		switch {
+		case step.Action != "":
+			payload, err := r.resolve(step.Payload)
+			if err != nil {
+				return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("%s: resolving payload: %w", step.label(i), err))
+			}
+			encPayload, err := json.Marshal(payload)
+			if err != nil {
+				return fmt.Errorf("%s: marshalling payload: %w", step.label(i), err)
+			}
+			sr.Action = step.Action
+			sr.Payload = encPayload
+			if dryRun {
+				out.Printf("%s: action %s with payload %s\n", step.label(i), step.Action, encPayload)
+				result.Steps = append(result.Steps, sr)
+				continue
+			}
+			in := &proto.ActionRequest{
+				Action:  step.Action,
+				Payload: encPayload,
+			}
+			resp, err := gc.Action(ctx, in)
+			if err != nil {
+				return fmt.Errorf("%s: calling manage service (calling backend action %q): %w", step.label(i), step.Action, fehler.FromGRPC(err))
+			}
+			applied++
+			if err := r.store(step.Name, resp.Payload); err != nil {
+				return fmt.Errorf("%s: %w", step.label(i), err)
+			}
+			out.Printf("%s: action %s was successful with following response: %s\n", step.label(i), step.Action, string(resp.Payload))
+			sr.Result = output.RawJSON(resp.Payload)
+
+		case step.Get != "":
+			in, err := r.getRequest(step)
+			if err != nil {
+				return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("%s: %w", step.label(i), err))
+			}
+			sr.Get = in.Collection
+			if dryRun {
+				out.Printf("%s: get %s with filter %s and fields %v\n", step.label(i), in.Collection, filterText(in), in.Fields)
+				result.Steps = append(result.Steps, sr)
+				continue
+			}
+			resp, err := gc.Get(ctx, in)
+			if err != nil {
+				return fmt.Errorf("%s: calling manage service (getting collection %s): %w", step.label(i), in.Collection, fehler.FromGRPC(err))
+			}
+			if err := r.store(step.Name, []byte(resp.Value)); err != nil {
+				return fmt.Errorf("%s: %w", step.label(i), err)
+			}
+			out.Printf("%s: get %s returned %s\n", step.label(i), in.Collection, resp.Value)
+			sr.Result = output.RawJSON([]byte(resp.Value))
+
+		case step.Assert != nil:
+			if err := r.assert(*step.Assert); err != nil {
+				return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("%s: %w", step.label(i), err))
+			}
+			sr.Assert = true
+			if dryRun {
+				out.Printf("%s: assertion is checked when the plan is applied\n", step.label(i))
+				result.Steps = append(result.Steps, sr)
+				continue
+			}
+			out.Printf("%s: assertion holds\n", step.label(i))
+		}
+		result.Steps = append(result.Steps, sr)
+	}
+	return out.Result(result)
+}
+
+// planResult is the result of a plan in JSON output format.
+type planResult struct {
+	DryRun bool         `json:"dry_run"`
+	Steps  []stepResult `json:"steps"`
+}
+
+// stepResult is the result of a single step in JSON output format.
+type stepResult struct {
+	Step    string          `json:"step"`
+	Action  string          `json:"action,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Get     string          `json:"get,omitempty"`
+	Assert  bool            `json:"assert,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+}
+
+// getRequest builds the get request for the given step.
+func (r resolver) getRequest(s Step) (*proto.GetRequest, error) {
+	if s.Filter != nil && s.FilterRaw != nil {
+		return nil, fmt.Errorf("simple and raw filter provided, only either is allowed")
+	}
+	if s.Exists && s.Filter == nil && s.FilterRaw == nil {
+		return nil, fmt.Errorf("filter missing, needed to check existance of a model")
+	}
+
+	in := &proto.GetRequest{
+		Collection: s.Get,
+		Exists:     s.Exists,
+		Fields:     s.Fields,
+	}
+	if s.Filter != nil {
+		in.Filter = make(map[string]string, len(s.Filter))
+		for k, v := range s.Filter {
+			resolved, err := r.resolve(v)
+			if err != nil {
+				return nil, fmt.Errorf("resolving filter %q: %w", k, err)
+			}
+			in.Filter[k] = filterValue(resolved)
+		}
+	}
+	if s.FilterRaw != nil {
+		filter, err := r.resolve(s.FilterRaw)
+		if err != nil {
+			return nil, fmt.Errorf("resolving raw filter: %w", err)
+		}
+		encFilter, err := json.Marshal(filter)
+		if err != nil {
+			return nil, fmt.Errorf("marshalling raw filter: %w", err)
+		}
+		in.FilterRaw = string(encFilter)
+	}
+	return in, nil
+}
+
+// filterValue returns the value of a simple filter as string. Numbers from
+// YAML or from results are printed without exponent, so ids stay intact.
+func filterValue(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func filterText(in *proto.GetRequest) string {
+	if in.FilterRaw != "" {
+		return in.FilterRaw
+	}
+	if in.Filter == nil {
+		return "{}"
+	}
+	encFilter, _ := json.Marshal(in.Filter) // A map of strings can always be marshalled.
+	return string(encFilter)
+}
+
+// Variables
+
+// referenceRegex matches references like ${vars.name} or ${steps.name.result[0].id}.
+var referenceRegex = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// resolver replaces references in plan values with variables and results of
+// earlier steps.
+type resolver struct {
+	vars    map[string]interface{}
+	results map[string]interface{}
+
+	// lenient leaves references to results of steps that did not run yet
+	// untouched instead of returning an error. This is used in dry-run mode.
+	lenient bool
+}
+
+// store saves the given JSON encoded result of the step with the given name.
+// Results of unnamed steps can not be referenced so they are dropped.
+func (r resolver) store(name string, result []byte) error {
+	if name == "" {
+		return nil
+	}
+	var v interface{}
+	if len(result) > 0 {
+		if err := json.Unmarshal(result, &v); err != nil {
+			return fmt.Errorf("unmarshalling result %q: %w", string(result), err)
+		}
+	}
+	r.results[name] = v
+	return nil
+}
+
+// resolve walks through the given value and resolves all references in
+// strings.
+func (r resolver) resolve(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		return r.resolveString(val)
+	case []interface{}:
+		l := make([]interface{}, len(val))
+		for i, item := range val {
+			resolved, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = resolved
+		}
+		return l, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			resolved, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = resolved
+		}
+		return m, nil
+	default:
+		return v, nil
+	}
+}
+
+// resolveString resolves all references in the given string. If the string
+// consists only of one reference, the referenced value is returned as it is.
+// Else all references are formatted and inserted into the string.
+func (r resolver) resolveString(s string) (interface{}, error) {
+	matches := referenceRegex.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) {
+		v, ok, err := r.lookup(s[matches[0][2]:matches[0][3]])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return s, nil
+		}
+		return v, nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m[0]])
+		v, ok, err := r.lookup(s[m[2]:m[3]])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			b.WriteString(s[m[0]:m[1]])
+		} else {
+			text, err := formatValue(v)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(text)
+		}
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
+
+// lookup returns the value of the given reference. The boolean is false if the
+// reference points to a step that did not run yet and the resolver is lenient.
+func (r resolver) lookup(ref string) (interface{}, bool, error) {
+	segments, err := splitPath(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid reference %q: %w", ref, err)
+	}
+
+	var v interface{}
+	switch {
+	case len(segments) >= 2 && segments[0] == "vars":
+		val, ok := r.vars[segments[1]]
+		if !ok {
+			return nil, false, fmt.Errorf("invalid reference %q: unknown variable %q", ref, segments[1])
+		}
+		v = val
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "steps" && segments[2] == "result":
+		val, ok := r.results[segments[1]]
+		if !ok {
+			if r.lenient {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("invalid reference %q: step %q has no result (yet)", ref, segments[1])
+		}
+		v = val
+		segments = segments[3:]
+	default:
+		return nil, false, fmt.Errorf("invalid reference %q: must start with vars.<name> or steps.<name>.result", ref)
+	}
+
+	for _, seg := range segments {
+		switch val := v.(type) {
+		case []interface{}:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(val) {
+				return nil, false, fmt.Errorf("invalid reference %q: index %q out of range", ref, seg)
+			}
+			v = val[idx]
+		case map[string]interface{}:
+			item, ok := val[seg]
+			if !ok {
+				return nil, false, fmt.Errorf("invalid reference %q: key %q not found", ref, seg)
+			}
+			v = item
+		default:
+			return nil, false, fmt.Errorf("invalid reference %q: can not descend into %q", ref, seg)
+		}
+	}
+	return v, true, nil
+}
+
+// splitPath splits a path like steps.name.result[0].id into its segments.
+func splitPath(p string) ([]string, error) {
+	var segments []string
+	for _, part := range strings.Split(p, ".") {
+		for {
+			i := strings.Index(part, "[")
+			if i == -1 {
+				break
+			}
+			j := strings.Index(part, "]")
+			if j < i {
+				return nil, fmt.Errorf("unbalanced brackets")
+			}
+			if i > 0 {
+				segments = append(segments, part[:i])
+			}
+			segments = append(segments, part[i+1:j])
+			part = part[j+1:]
+		}
+		if part != "" {
+			segments = append(segments, part)
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return segments, nil
+}
+
+// formatValue returns the given value as text for insertion into a string.
+func formatValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case bool, nil:
+		return fmt.Sprint(val), nil
+	default:
+		encVal, err := json.Marshal(val)
+		if err != nil {
+			return "", fmt.Errorf("marshalling value: %w", err)
+		}
+		return string(encVal), nil
+	}
+}
+
+// Assertions
+
+// assert checks the given assertion. References that can not be resolved yet
+// (in dry-run mode) let the assertion pass.
+func (r resolver) assert(a Assertion) error {
+	value, err := r.resolve(a.Value)
+	if err != nil {
+		return fmt.Errorf("resolving value: %w", err)
+	}
+	if s, ok := value.(string); ok && referenceRegex.MatchString(s) && r.lenient {
+		return nil
+	}
+
+	msg := a.Message
+	if msg == "" {
+		msg = "assertion failed"
+	}
+
+	if a.NotEmpty && isEmpty(value) {
+		return fmt.Errorf("%s: value is empty", msg)
+	}
+	if a.Equals != nil {
+		expected, err := r.resolve(a.Equals)
+		if err != nil {
+			return fmt.Errorf("resolving expected value: %w", err)
+		}
+		if !equal(value, expected) {
+			return fmt.Errorf("%s: expected %v, got %v", msg, expected, value)
+		}
+	}
+	return nil
+}
+
+func isEmpty(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !val
+	case float64:
+		return val == 0
+	case string:
+		return val == ""
+	case []interface{}:
+		return len(val) == 0
+	case map[string]interface{}:
+		return len(val) == 0
+	default:
+		return false
+	}
+}
+
+// equal compares two values. Strings are also considered equal to their
+// formatted counterparts so that e. g. "42" equals 42.
+func equal(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	textA, errA := formatValue(a)
+	textB, errB := formatValue(b)
+	return errA == nil && errB == nil && textA == textB
+}
@@ -0,0 +1,211 @@
+package apply_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/apply"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"google.golang.org/grpc"
+)
+
+func TestCmd(t *testing.T) {
+	t.Skip("this test does not work because there is no (fake) server running")
+	t.Run("executing apply.Cmd()", func(t *testing.T) {
+		// cmd := apply.Cmd()
+		// if err := cmd.Execute(); err != nil {
+		// 	t.Fatalf("executing apply subcommand: %v", err)
+		// }
+	})
+}
+
+// Plan tests
+
+func TestParsePlan(t *testing.T) {
+	t.Run("valid plan", func(t *testing.T) {
+		plan := `---
+steps:
+  - name: user
+    action: user.create
+    payload: [{username: foo}]
+  - get: user
+  - assert:
+      value: 1
+`
+		p, err := apply.ParsePlan([]byte(plan))
+		if err != nil {
+			t.Fatalf("parsing plan failed: %v", err)
+		}
+		if len(p.Steps) != 3 {
+			t.Fatalf("wrong number of steps, expected 3, got %d", len(p.Steps))
+		}
+	})
+
+	t.Run("invalid plans", func(t *testing.T) {
+		for _, tt := range []struct {
+			name      string
+			plan      string
+			hasErrMsg string
+		}{
+			{"no steps", "vars: {a: 1}", "does not contain any steps"},
+			{"two kinds", "steps: [{action: user.create, get: user}]", "exactly one of action, get and assert"},
+			{"no kind", "steps: [{name: foo}]", "exactly one of action, get and assert"},
+			{"duplicate names", "steps: [{name: a, get: user}, {name: a, get: user}]", `duplicate step name "a"`},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := apply.ParsePlan([]byte(tt.plan))
+				if err == nil {
+					t.Fatalf("parsing plan should fail but it didn't")
+				}
+				if !strings.Contains(err.Error(), tt.hasErrMsg) {
+					t.Fatalf("got error message %q, expected %q", err.Error(), tt.hasErrMsg)
+				}
+			})
+		}
+	})
+}
+
+// Client tests
+
+type mockApplyClient struct {
+	actions []*proto.ActionRequest
+	gets    []*proto.GetRequest
+	nextID  int
+}
+
+func (m *mockApplyClient) Action(ctx context.Context, in *proto.ActionRequest, opts ...grpc.CallOption) (*proto.ActionResponse, error) {
+	m.actions = append(m.actions, in)
+	m.nextID++
+	return &proto.ActionResponse{Payload: []byte(fmt.Sprintf(`[{"id": %d}]`, m.nextID))}, nil
+}
+
+func (m *mockApplyClient) Get(ctx context.Context, in *proto.GetRequest, opts ...grpc.CallOption) (*proto.GetResponse, error) {
+	m.gets = append(m.gets, in)
+	return &proto.GetResponse{Value: `{"2": {"id": 2, "name": "Meeting Ohr3uY3a"}}`}, nil
+}
+
+func TestRun(t *testing.T) {
+	plan := `---
+vars:
+  committee_name: Committee aiW5ohfa
+steps:
+  - name: committee
+    action: committee.create
+    payload:
+      - name: ${vars.committee_name}
+        organization_id: 1
+  - name: meeting
+    action: meeting.create
+    payload:
+      - committee_id: ${steps.committee.result[0].id}
+        name: Meeting of committee ${steps.committee.result.0.id}
+  - name: lookup
+    get: meeting
+    filter:
+      id: ${steps.meeting.result[0].id}
+    fields: [name]
+  - assert:
+      value: ${steps.lookup.result.2.id}
+      equals: ${steps.meeting.result[0].id}
+`
+	p, err := apply.ParsePlan([]byte(plan))
+	if err != nil {
+		t.Fatalf("parsing plan failed: %v", err)
+	}
+
+	t.Run("apply plan", func(t *testing.T) {
+		mc := new(mockApplyClient)
+		if err := apply.Run(context.Background(), mc, p, false); err != nil {
+			t.Fatalf("running apply.Run() failed with error: %v", err)
+		}
+		if len(mc.actions) != 2 || len(mc.gets) != 1 {
+			t.Fatalf("wrong number of calls, expected 2 actions and 1 get, got %d and %d", len(mc.actions), len(mc.gets))
+		}
+
+		var got []map[string]interface{}
+		if err := json.Unmarshal(mc.actions[1].Payload, &got); err != nil {
+			t.Fatalf("unmarshalling payload of second action: %v", err)
+		}
+		if got[0]["committee_id"] != float64(1) {
+			t.Fatalf("wrong committee_id, expected 1 as number, got %v (%T)", got[0]["committee_id"], got[0]["committee_id"])
+		}
+		if got[0]["name"] != "Meeting of committee 1" {
+			t.Fatalf("wrong name, expected %q, got %q", "Meeting of committee 1", got[0]["name"])
+		}
+		if mc.gets[0].Filter["id"] != "2" {
+			t.Fatalf("wrong filter, expected id 2, got %q", mc.gets[0].Filter["id"])
+		}
+	})
+
+	t.Run("filter with numbers and booleans", func(t *testing.T) {
+		plan := `steps: [{get: user, filter: {id: 2, is_active: true, organization_id: 10000000, username: admin}}]`
+		p, err := apply.ParsePlan([]byte(plan))
+		if err != nil {
+			t.Fatalf("parsing plan failed: %v", err)
+		}
+
+		mc := new(mockApplyClient)
+		if err := apply.Run(context.Background(), mc, p, false); err != nil {
+			t.Fatalf("running apply.Run() failed with error: %v", err)
+		}
+		expected := map[string]string{"id": "2", "is_active": "true", "organization_id": "10000000", "username": "admin"}
+		if len(mc.gets) != 1 || !reflect.DeepEqual(mc.gets[0].Filter, expected) {
+			t.Fatalf("wrong filter, expected %v, got %v", expected, mc.gets)
+		}
+	})
+
+	t.Run("dry-run", func(t *testing.T) {
+		if err := apply.Run(context.Background(), nil, p, true); err != nil {
+			t.Fatalf("running apply.Run() in dry-run mode failed with error: %v", err)
+		}
+	})
+
+	t.Run("failing assertion", func(t *testing.T) {
+		p, err := apply.ParsePlan([]byte(`steps: [{name: c, action: committee.create}, {assert: {value: "${steps.c.result[0].id}", equals: 42, message: wrong id}}]`))
+		if err != nil {
+			t.Fatalf("parsing plan failed: %v", err)
+		}
+		err = apply.Run(context.Background(), new(mockApplyClient), p, false)
+		if err == nil {
+			t.Fatalf("running apply.Run() should fail but it didn't")
+		}
+		if !strings.Contains(err.Error(), "wrong id: expected 42, got 1") {
+			t.Fatalf("wrong error message, got %q", err.Error())
+		}
+	})
+
+	t.Run("partial success", func(t *testing.T) {
+		p, err := apply.ParsePlan([]byte(`steps: [{action: committee.create}, {assert: {value: false, not_empty: true}}]`))
+		if err != nil {
+			t.Fatalf("parsing plan failed: %v", err)
+		}
+		err = apply.Run(context.Background(), new(mockApplyClient), p, false)
+		var errExit interface {
+			ExitCode() int
+		}
+		if !errors.As(err, &errExit) || errExit.ExitCode() != fehler.ExitPartialSuccess {
+			t.Fatalf("running apply.Run() should fail with partial success exit code, got %v", err)
+		}
+	})
+
+	t.Run("unknown reference", func(t *testing.T) {
+		p, err := apply.ParsePlan([]byte(`steps: [{action: committee.create, payload: ["${steps.unknown.result}"]}]`))
+		if err != nil {
+			t.Fatalf("parsing plan failed: %v", err)
+		}
+		mc := new(mockApplyClient)
+		err = apply.Run(context.Background(), mc, p, false)
+		if err == nil {
+			t.Fatalf("running apply.Run() should fail but it didn't")
+		}
+		if len(mc.actions) != 0 {
+			t.Fatalf("gRPC client was called")
+		}
+	})
+}
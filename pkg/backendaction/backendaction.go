@@ -10,10 +10,17 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/metrics"
 	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/pkg/tracing"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -28,6 +35,24 @@ const (
 	requestTimeout = 5 * time.Second
 )
 
+var (
+	actionCalls = metrics.NewCounter(
+		"openslides_manage_backend_action_calls_total",
+		"Number of backend action calls by action and result.",
+		"action", "result",
+	)
+	backendRequests = metrics.NewCounter(
+		"openslides_manage_backend_requests_total",
+		"Number of HTTP requests to the backend including retries by URL and result.",
+		"url", "result",
+	)
+	backendRetries = metrics.NewCounter(
+		"openslides_manage_backend_retries_total",
+		"Number of retried HTTP requests to the backend by URL.",
+		"url",
+	)
+)
+
 // Conn holds a connection to the backend action service.
 type Conn struct {
 	URL                  *url.URL
@@ -59,7 +84,15 @@ func New(url *url.URL, pw []byte, route string) *Conn {
 }
 
 // Single sends a request to backend action service with a single action.
-func (c *Conn) Single(ctx context.Context, name string, data json.RawMessage) (json.RawMessage, error) {
+func (c *Conn) Single(ctx context.Context, name string, data json.RawMessage) (result json.RawMessage, err error) {
+	defer func() {
+		if err != nil {
+			actionCalls.Inc(name, "error")
+			return
+		}
+		actionCalls.Inc(name, "success")
+	}()
+
 	if c.route != ActionRoute {
 		return nil, fmt.Errorf("invalid route for this connection; expected %q, got %q", ActionRoute, c.route)
 	}
@@ -96,6 +129,9 @@ func (c *Conn) Single(ctx context.Context, name string, data json.RawMessage) (j
 	if err := json.Unmarshal(res, &content); err != nil {
 		return nil, fmt.Errorf("unmarshalling response body: %w", err)
 	}
+	if !content.Success {
+		return nil, parseError(http.StatusOK, res)
+	}
 	if len(content.Results) != 1 {
 		return nil, fmt.Errorf("response body content should have one item, but has %d", len(content.Results))
 	}
@@ -139,11 +175,16 @@ func (c *Conn) Health(ctx context.Context) (json.RawMessage, error) {
 	return res, nil
 }
 
-func executeRequest(ctx context.Context, method string, addr string, pw []byte, bodyReader io.Reader, requestTimeout time.Duration) (json.RawMessage, error) {
+func executeRequest(ctx context.Context, method string, addr string, pw []byte, bodyReader io.Reader, requestTimeout time.Duration) (result json.RawMessage, err error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
 
+	ctx, span := tracing.Start(ctx, "HTTP "+method, tracing.KindClient)
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("http.url", addr)
+	defer func() { span.Finish(err) }()
+
 	reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
 	defer cancel()
 
@@ -155,16 +196,19 @@ func executeRequest(ctx context.Context, method string, addr string, pw []byte,
 	creds := shared.BasicAuth{Password: pw}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set(shared.AuthHeader, creds.EncPassword())
+	tracing.Inject(ctx, req.Header)
+	shared.InjectRequestID(ctx, req.Header)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	span.SetAttribute("http.status_code", resp.StatusCode)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("server error response %d: %s", resp.StatusCode, string(respBody))
+		return nil, parseError(resp.StatusCode, respBody)
 	}
 
 	encodedResp, err := io.ReadAll(resp.Body)
@@ -204,11 +248,15 @@ func requestWithPassword(ctx context.Context, method string, addr string, pw []b
 
 		result, err := executeRequest(ctx, method, addr, pw, bodyReader, requestTimeout)
 		if err == nil {
+			backendRequests.Inc(addr, "success")
 			return result, nil
 		}
+		backendRequests.Inc(addr, "error")
 
 		lastErr = err
 		if isNetworkError(err) && attempt < maxRetries-1 {
+			backendRetries.Inc(addr)
+			shared.LoggerFromContext(ctx).Warningf("Request to %s failed (attempt %d of %d), retrying in %s: %v", addr, attempt+1, maxRetries, backoffDelay, err)
 			select {
 			case <-time.After(backoffDelay):
 				continue
@@ -223,6 +271,11 @@ func requestWithPassword(ctx context.Context, method string, addr string, pw []b
 }
 
 func isNetworkError(err error) bool {
+	var backendErr *Error
+	if errors.As(err, &backendErr) {
+		// The backend was reachable and answered.
+		return false
+	}
 	var urlErr *url.Error
 	if errors.As(err, &urlErr) {
 		err = urlErr.Err
@@ -260,3 +313,82 @@ func isNetworkError(err error) bool {
 	}
 	return false
 }
+
+// Error is an error response of the backend. It provides a gRPC status so the
+// manage server can forward the error with a proper status code and details.
+type Error struct {
+	StatusCode int
+
+	// Message is the message given by the backend or the raw response body if
+	// it could not be parsed.
+	Message string
+
+	// ActionErrorIndex and ActionDataErrorIndex point to the failing action
+	// and to the failing item of its payload if the backend provides them.
+	ActionErrorIndex     *int
+	ActionDataErrorIndex *int
+}
+
+// parseError builds an error from the given backend response. The body is
+// something like
+// {"success": false, "message": "...", "action_error_index": 0, "action_data_error_index": 0}
+func parseError(statusCode int, body []byte) *Error {
+	var content struct {
+		Message              string `json:"message"`
+		ActionErrorIndex     *int   `json:"action_error_index"`
+		ActionDataErrorIndex *int   `json:"action_data_error_index"`
+	}
+	if err := json.Unmarshal(body, &content); err != nil || content.Message == "" {
+		return &Error{StatusCode: statusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return &Error{
+		StatusCode:           statusCode,
+		Message:              content.Message,
+		ActionErrorIndex:     content.ActionErrorIndex,
+		ActionDataErrorIndex: content.ActionDataErrorIndex,
+	}
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("backend error response %d: %s", e.StatusCode, e.Message)
+	if e.ActionErrorIndex != nil {
+		msg += fmt.Sprintf(" (action index %d", *e.ActionErrorIndex)
+		if e.ActionDataErrorIndex != nil {
+			msg += fmt.Sprintf(", action data index %d", *e.ActionDataErrorIndex)
+		}
+		msg += ")"
+	}
+	return msg
+}
+
+// GRPCStatus returns the gRPC status for this error. The backend message and
+// the indices are attached as error details.
+func (e *Error) GRPCStatus() *status.Status {
+	code := fehler.CodeFromHTTP(e.StatusCode)
+	if e.StatusCode == http.StatusOK {
+		// The backend answered but the action failed.
+		code = codes.InvalidArgument
+	}
+
+	md := map[string]string{
+		"message":     e.Message,
+		"http_status": strconv.Itoa(e.StatusCode),
+	}
+	if e.ActionErrorIndex != nil {
+		md["action_error_index"] = strconv.Itoa(*e.ActionErrorIndex)
+	}
+	if e.ActionDataErrorIndex != nil {
+		md["action_data_error_index"] = strconv.Itoa(*e.ActionDataErrorIndex)
+	}
+
+	s := status.New(code, e.Error())
+	ds, err := s.WithDetails(&errdetails.ErrorInfo{
+		Reason:   fehler.ReasonBackend,
+		Domain:   fehler.Domain,
+		Metadata: md,
+	})
+	if err != nil {
+		return s
+	}
+	return ds
+}
@@ -1,7 +1,117 @@
 package backendaction_test
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/backendaction"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/tracing"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
 
 func TestAction(t *testing.T) {
 	t.Skip("No tests here. TODO")
 }
+
+func TestTraceparent(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+		w.Write([]byte(`{"success": true, "message": "", "results": [[{"id": 1}]]}`))
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("parsing URL of test server: %v", err)
+	}
+	c := backendaction.New(u, []byte("password"), backendaction.ActionRoute)
+
+	ctx, span := tracing.Start(context.Background(), "test", tracing.KindServer)
+	if _, err := c.Single(ctx, "user.create", []byte(`[{"username": "foo"}]`)); err != nil {
+		t.Fatalf("calling action: %v", err)
+	}
+
+	prefix := "00-" + span.TraceID + "-"
+	if !strings.HasPrefix(got, prefix) || strings.Contains(got, span.SpanID) {
+		t.Fatalf("traceparent header %q should belong to a child span of trace %s", got, span.TraceID)
+	}
+}
+
+func newTestConn(t testing.TB, statusCode int, body string) *backendaction.Conn {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("parsing URL of test server: %v", err)
+	}
+	return backendaction.New(u, []byte("password"), backendaction.ActionRoute)
+}
+
+func TestError(t *testing.T) {
+	t.Run("action error with indices", func(t *testing.T) {
+		body := `{"success": false, "message": "A user with the username foo already exists.", "action_error_index": 0, "action_data_error_index": 1}`
+		c := newTestConn(t, http.StatusBadRequest, body)
+
+		_, err := c.Single(context.Background(), "user.create", []byte(`[{"username": "foo"}]`))
+		var backendErr *backendaction.Error
+		if !errors.As(err, &backendErr) {
+			t.Fatalf("expected backend error, got %v", err)
+		}
+		if backendErr.Message != "A user with the username foo already exists." {
+			t.Fatalf("wrong message, got %q", backendErr.Message)
+		}
+		if backendErr.ActionErrorIndex == nil || *backendErr.ActionErrorIndex != 0 {
+			t.Fatalf("wrong action error index, got %v", backendErr.ActionErrorIndex)
+		}
+		if backendErr.ActionDataErrorIndex == nil || *backendErr.ActionDataErrorIndex != 1 {
+			t.Fatalf("wrong action data error index, got %v", backendErr.ActionDataErrorIndex)
+		}
+
+		s := backendErr.GRPCStatus()
+		if s.Code() != codes.InvalidArgument {
+			t.Fatalf("wrong status code, expected %s, got %s", codes.InvalidArgument, s.Code())
+		}
+		if len(s.Details()) != 1 {
+			t.Fatalf("wrong number of status details, expected 1, got %d", len(s.Details()))
+		}
+		info, ok := s.Details()[0].(*errdetails.ErrorInfo)
+		if !ok || info.Reason != fehler.ReasonBackend || info.Metadata["action_data_error_index"] != "1" {
+			t.Fatalf("wrong status details, got %v", s.Details()[0])
+		}
+	})
+
+	t.Run("status codes", func(t *testing.T) {
+		for _, tt := range []struct {
+			statusCode int
+			expected   codes.Code
+		}{
+			{http.StatusForbidden, codes.PermissionDenied},
+			{http.StatusNotFound, codes.NotFound},
+			{http.StatusBadGateway, codes.Unavailable},
+		} {
+			c := newTestConn(t, tt.statusCode, "some text that is not JSON")
+			_, err := c.Single(context.Background(), "user.create", []byte(`[]`))
+			var backendErr *backendaction.Error
+			if !errors.As(err, &backendErr) {
+				t.Fatalf("expected backend error, got %v", err)
+			}
+			if backendErr.Message != "some text that is not JSON" {
+				t.Fatalf("wrong message, got %q", backendErr.Message)
+			}
+			if got := backendErr.GRPCStatus().Code(); got != tt.expected {
+				t.Fatalf("wrong status code for HTTP status %d, expected %s, got %s", tt.statusCode, tt.expected, got)
+			}
+		}
+	})
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/metrics"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
 )
 
 const (
@@ -30,12 +33,19 @@ func Cmd() *cobra.Command {
 		Args:  cobra.NoArgs,
 	}
 	cp := connection.Unary(cmd)
+	fl := connection.Multi(cmd, cp)
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
+		if fl.Enabled() {
+			return fl.Run(cmd, func(ctx context.Context, cl proto.ManageClient, _ connection.Params) error {
+				return Run(ctx, cl)
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := cp.Dial(ctx)
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -62,8 +72,7 @@ func Run(ctx context.Context, gc gRPCClient) error {
 	for {
 		resp, err := gc.CheckServer(ctx, req)
 		if err != nil {
-			s, _ := status.FromError(err) // The ok value does not matter here.
-			return fmt.Errorf("calling manage service (checking server): %s", s.Message())
+			return fmt.Errorf("calling manage service (checking server): %w", fehler.FromGRPC(err))
 		}
 		if resp.Ready {
 			break
@@ -72,8 +81,9 @@ func Run(ctx context.Context, gc gRPCClient) error {
 
 	// We reach this line only if the check server request was successful and
 	// the context was not canceled (e. g. deadline exceeded).
-	fmt.Println("Server is ready.")
-	return nil
+	p := output.FromContext(ctx)
+	p.Printf("Server is ready.\n")
+	return p.Result(map[string]bool{"ready": true})
 }
 
 // Server
@@ -82,14 +92,30 @@ type backendAction interface {
 	Health(context.Context) (json.RawMessage, error)
 }
 
+var (
+	checkReady = metrics.NewGauge(
+		"openslides_manage_check_server_ready",
+		"Result of the last check server call by service (1 for ready, 0 for not ready).",
+		"service",
+	)
+	checkTime = metrics.NewGauge(
+		"openslides_manage_check_server_last_check_timestamp_seconds",
+		"Unix time of the last check server call by service.",
+		"service",
+	)
+)
+
 // CheckServer sends a health request to backend manage service.
 func CheckServer(ctx context.Context, in *proto.CheckServerRequest, ba backendAction) *proto.CheckServerResponse {
 	_, err := ba.Health(ctx)
+	checkTime.Set(float64(time.Now().Unix()), "backendManage")
 	if err != nil {
+		checkReady.Set(0, "backendManage")
 		// Special error handling here: We do not return the (wrapped) error but
 		// a response with falsy value.
 		return &proto.CheckServerResponse{Ready: false}
 
 	}
+	checkReady.Set(1, "backendManage")
 	return &proto.CheckServerResponse{Ready: true}
 }
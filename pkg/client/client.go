@@ -3,44 +3,65 @@ package client
 import (
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/action"
+	"github.com/OpenSlides/openslides-manage-service/pkg/apply"
 	"github.com/OpenSlides/openslides-manage-service/pkg/checkserver"
 	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
 	"github.com/OpenSlides/openslides-manage-service/pkg/createuser"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
 	"github.com/OpenSlides/openslides-manage-service/pkg/get"
 	"github.com/OpenSlides/openslides-manage-service/pkg/initialdata"
 	"github.com/OpenSlides/openslides-manage-service/pkg/migrations"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
 	"github.com/OpenSlides/openslides-manage-service/pkg/set"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setpassword"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/OpenSlides/openslides-manage-service/pkg/syncstate"
 	"github.com/OpenSlides/openslides-manage-service/pkg/version"
 	"github.com/spf13/cobra"
 )
 
 // RunClient is the entrypoint for the client tool of this service. It starts the root command.
 func RunClient() int {
-	err := RootCmd().Execute()
+	cmd := RootCmd()
+	err := cmd.Execute()
 
 	if err == nil {
 		return 0
 	}
 
-	code := 1
+	code := fehler.ExitGeneral
 	var errExit interface {
 		ExitCode() int
 	}
 	if errors.As(err, &errExit) {
 		code = errExit.ExitCode()
 		if code <= 0 {
-			code = 1
+			code = fehler.ExitGeneral
 			err = fmt.Errorf("wrong error code for error: %w", err)
 		}
 	}
-	fmt.Printf("Error: %v\n", err)
+
+	format, _ := cmd.PersistentFlags().GetString(outputFlag) // The flag is always defined.
+	if p, pErr := output.New(os.Stdout, format); pErr == nil && p.JSON() {
+		if output.IsReported(err) {
+			return code
+		}
+		if err := p.Error(err, code); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return code
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 	return code
 }
 
+const outputFlag = "output"
+
 // RootHelp is the main help text for the client tool.
 const RootHelp = `openslides is an admin tool to setup an OpenSlides instance and perform manager actions on it.`
 
@@ -54,6 +75,20 @@ func RootCmd() *cobra.Command {
 		SilenceUsage:      true,
 		CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
 	}
+	cmd.SetFlagErrorFunc(func(c *cobra.Command, err error) error {
+		return fehler.ExitCode(fehler.ExitValidation, err)
+	})
+
+	outputHelpText := fmt.Sprintf("output format, use %q to get exactly one JSON document including errors", output.FormatJSON)
+	format := cmd.PersistentFlags().StringP(outputFlag, "o", output.FormatText, outputHelpText)
+	cmd.PersistentPreRunE = func(c *cobra.Command, args []string) error {
+		p, err := output.New(c.OutOrStdout(), *format)
+		if err != nil {
+			return fehler.ExitCode(fehler.ExitValidation, err)
+		}
+		c.SetContext(output.NewContext(c.Context(), p))
+		return nil
+	}
 
 	cmd.AddCommand(
 		setup.Cmd(),
@@ -67,7 +102,11 @@ func RootCmd() *cobra.Command {
 		get.Cmd(),
 		set.Cmd(),
 		action.Cmd(),
+		apply.Cmd(),
+		syncstate.Cmd(),
 		version.Cmd(),
+		secrets.Cmd(),
+		connection.ContextCmd(),
 	)
 
 	return cmd
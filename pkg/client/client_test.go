@@ -2,19 +2,23 @@ package client_test
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"testing"
 
+	"github.com/OpenSlides/openslides-manage-service/pkg/apply"
 	"github.com/OpenSlides/openslides-manage-service/pkg/checkserver"
 	"github.com/OpenSlides/openslides-manage-service/pkg/client"
 	"github.com/OpenSlides/openslides-manage-service/pkg/config"
 	"github.com/OpenSlides/openslides-manage-service/pkg/createuser"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
 	"github.com/OpenSlides/openslides-manage-service/pkg/get"
 	"github.com/OpenSlides/openslides-manage-service/pkg/initialdata"
 	"github.com/OpenSlides/openslides-manage-service/pkg/migrations"
 	"github.com/OpenSlides/openslides-manage-service/pkg/set"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setpassword"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/OpenSlides/openslides-manage-service/pkg/syncstate"
 	"github.com/OpenSlides/openslides-manage-service/pkg/version"
 )
 
@@ -97,6 +101,18 @@ func TestCmdHelpTexts(t *testing.T) {
 			outputStartsWith: []byte(set.SetHelp),
 		},
 
+		{
+			name:             "apply command",
+			input:            []string{"apply", "--help"},
+			outputStartsWith: []byte(apply.ApplyHelp),
+		},
+
+		{
+			name:             "sync command",
+			input:            []string{"sync", "--help"},
+			outputStartsWith: []byte(syncstate.SyncHelp),
+		},
+
 		{
 			name:             "version",
 			input:            []string{"version", "--help"},
@@ -124,3 +140,16 @@ func TestCmdHelpTexts(t *testing.T) {
 		})
 	}
 }
+
+func TestOutputFlag(t *testing.T) {
+	cmd := client.RootCmd()
+	cmd.SetArgs([]string{"version", "--output", "xml"})
+
+	err := cmd.Execute()
+	var errExit interface {
+		ExitCode() int
+	}
+	if !errors.As(err, &errExit) || errExit.ExitCode() != fehler.ExitValidation {
+		t.Fatalf("executing command with unknown output format should fail with validation exit code, got %v", err)
+	}
+}
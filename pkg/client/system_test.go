@@ -50,7 +50,7 @@ func TestSystemInTotal(t *testing.T) {
 
 	t.Run("initial-data", func(t *testing.T) {
 		cmd := client.RootCmd()
-		cmd.SetArgs([]string{"initial-data", "--password-file", path.Join(dir, "secrets", "manage_auth_password")})
+		cmd.SetArgs([]string{"initial-data", "--password-file", path.Join(dir, "secrets", "manage_auth_password"), "--ca-file", path.Join(dir, "secrets", "cert_crt")})
 		if err := cmd.Execute(); err != nil {
 			t.Fatalf("executing command returns error %v", err)
 		}
@@ -58,7 +58,7 @@ func TestSystemInTotal(t *testing.T) {
 
 	t.Run("version", func(t *testing.T) {
 		cmd := client.RootCmd()
-		cmd.SetArgs([]string{"version", "--password-file", path.Join(dir, "secrets", "manage_auth_password")})
+		cmd.SetArgs([]string{"version", "--password-file", path.Join(dir, "secrets", "manage_auth_password"), "--ca-file", path.Join(dir, "secrets", "cert_crt")})
 		if err := cmd.Execute(); err != nil {
 			t.Fatalf("executing command returns error %v", err)
 		}
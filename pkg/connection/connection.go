@@ -3,11 +3,18 @@ package connection
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
 	"os"
 	"path"
+	"strings"
 	"time"
 
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
 	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
 	"github.com/OpenSlides/openslides-manage-service/proto"
@@ -30,11 +37,28 @@ type Params struct {
 	PasswordFile *string
 	Timeout      *time.Duration
 	NoSSL        *bool
+
+	CAFile             *string
+	ServerName         *string
+	ClientCert         *string
+	ClientKey          *string
+	InsecureSkipVerify *bool
+
+	// Context is the name of the context in the client config file.
+	Context *string
 }
 
-// Dial creates a gRPC connection to the server.
-func Dial(ctx context.Context, address, passwordFile string, ssl bool) (proto.ManageClient, func() error, error) {
-	pw, err := shared.AuthSecret(passwordFile, os.Getenv("OPENSLIDES_DEVELOPMENT"))
+// Dial creates a gRPC connection to the server. If tlsConfig is nil, an
+// unencrypted connection is used.
+//
+// The address is a TCP address like localhost:9008 or a Unix domain socket
+// like unix:///run/manage.sock.
+func Dial(ctx context.Context, address, passwordFile string, tlsConfig *tls.Config) (proto.ManageClient, func() error, error) {
+	if strings.HasPrefix(address, "unix://") && !strings.HasPrefix(address, "unix:///") {
+		return nil, nil, fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("invalid address %q: socket path has to be absolute, e. g. unix:///run/manage.sock", address))
+	}
+
+	pw, err := secrets.AuthSecret(passwordFile, os.Getenv("OPENSLIDES_DEVELOPMENT"))
 	if err != nil {
 		return nil, nil, fmt.Errorf("getting server auth secret: %w", err)
 	}
@@ -43,38 +67,219 @@ func Dial(ctx context.Context, address, passwordFile string, ssl bool) (proto.Ma
 	}
 
 	transportOption := grpc.WithInsecure() // Option for unencrypted HTTP connection
-	if ssl {
-		// TODO: Have a look at https://itnext.io/practical-guide-to-securing-grpc-connections-with-go-and-tls-part-1-f63058e9d6d1 and
-		// try not to use InsecureSkipVerify by default.
-		transCreds := credentials.NewTLS(&tls.Config{
-			InsecureSkipVerify: true,
-		})
-		transportOption = grpc.WithTransportCredentials(transCreds)
+	if tlsConfig != nil {
+		transportOption = grpc.WithTransportCredentials(permanentCertErrors{credentials.NewTLS(tlsConfig)})
 	}
 
 	conn, err := grpc.DialContext(ctx, address,
 		transportOption,
 		grpc.WithBlock(),
+		// Errors like an invalid server certificate are returned at once
+		// instead of waiting for the timeout. Network errors are retried, so
+		// the server may still be starting.
+		grpc.WithContextDialer(dialRetry),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithReturnConnectionError(),
 		grpc.WithPerRPCCredentials(creds),
 	)
 	if err != nil {
-		return nil, nil, fmt.Errorf("creating gRPC client connection with grpc.DialContext(): %w", err)
+		return nil, nil, fehler.ExitCode(fehler.ExitConnection, fmt.Errorf("creating gRPC client connection with grpc.DialContext(): %w", err))
 	}
 	return proto.NewManageClient(conn), conn.Close, nil
 }
 
+// dialRetry connects to the TCP address or Unix domain socket. All errors are
+// marked as temporary, so gRPC retries them until the timeout.
+func dialRetry(ctx context.Context, addr string) (net.Conn, error) {
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") {
+		network = "unix"
+		addr = strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//")
+	}
+	conn, err := new(net.Dialer).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, temporaryError{err}
+	}
+	return conn, nil
+}
+
+// temporaryError is an error that gRPC retries.
+type temporaryError struct {
+	error
+}
+
+// Temporary is used by gRPC to decide whether to retry.
+func (temporaryError) Temporary() bool {
+	return true
+}
+
+func (err temporaryError) Unwrap() error {
+	return err.error
+}
+
+// permanentCertErrors wraps transport credentials, so that an invalid server
+// certificate aborts a blocking dial. Else gRPC retries the handshake until the
+// timeout.
+type permanentCertErrors struct {
+	credentials.TransportCredentials
+}
+
+// ClientHandshake implements credentials.TransportCredentials.
+func (c permanentCertErrors) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	if err != nil && isCertError(err) {
+		return nil, nil, permanentError{err}
+	}
+	return conn, info, err
+}
+
+// Clone implements credentials.TransportCredentials.
+func (c permanentCertErrors) Clone() credentials.TransportCredentials {
+	return permanentCertErrors{c.TransportCredentials.Clone()}
+}
+
+func isCertError(err error) bool {
+	var errAuthority x509.UnknownAuthorityError
+	var errHostname x509.HostnameError
+	var errInvalid x509.CertificateInvalidError
+	return errors.As(err, &errAuthority) || errors.As(err, &errHostname) || errors.As(err, &errInvalid)
+}
+
+// permanentError is an error that gRPC does not retry.
+type permanentError struct {
+	error
+}
+
+// Temporary is used by gRPC to decide whether to retry.
+func (permanentError) Temporary() bool {
+	return false
+}
+
+func (err permanentError) Unwrap() error {
+	return err.error
+}
+
+// Dial creates a gRPC connection to the server using the parameters.
+func (p Params) Dial(ctx context.Context) (proto.ManageClient, func() error, error) {
+	tlsConfig, err := p.TLSConfig()
+	if err != nil {
+		return nil, nil, fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("creating TLS configuration: %w", err))
+	}
+	return Dial(ctx, *p.Addr, *p.PasswordFile, tlsConfig)
+}
+
+// TLSConfig returns the TLS configuration for the connection or nil if SSL is
+// disabled.
+//
+// The server certificate is verified against the CA file if given. Else the
+// system pool is used together with the certificate created by the setup
+// command, if it exists in the current directory.
+func (p Params) TLSConfig() (*tls.Config, error) {
+	if *p.NoSSL {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: *p.ServerName,
+	}
+
+	if *p.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	} else {
+		pool, err := rootCAs(*p.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (*p.ClientCert == "") != (*p.ClientKey == "") {
+		return nil, fmt.Errorf("client certificate and client key have to be given both")
+	}
+	if *p.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(*p.ClientCert, *p.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate and key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// rootCAs returns the pool of CA certificates to verify the server.
+func rootCAs(caFile string) (*x509.CertPool, error) {
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in CA file %q", caFile)
+		}
+		return pool, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	setupCert := path.Join(".", setup.SecretsDirName, setup.CertCertName)
+	pem, err := os.ReadFile(setupCert)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return pool, nil
+		}
+		return nil, fmt.Errorf("reading certificate file %q: %w", setupCert, err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no valid certificate found in %q, decrypt the secrets directory or use --ca-file", setupCert)
+	}
+	return pool, nil
+}
+
 // Unary provides parameters for an unary connection like address, passwordfile,
-// timeout and the noSSL flag to the given cobra command.
+// timeout, the noSSL flag and the TLS flags to the given cobra command.
+//
+// Flags that are not given are taken from OPENSLIDES_* environment variables
+// or from the context in the client config file before the command runs, see
+// Params.Resolve.
 func Unary(cmd *cobra.Command) Params {
-	addr := cmd.Flags().StringP("address", "a", defaultAddr, "address of the OpenSlides manage service")
+	p := flags(cmd)
+	p.Context = cmd.Flags().String(contextFlag, "", "name of the context in the client config file, defaults to the current context")
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		return p.Resolve(cmd)
+	}
+	return p
+}
+
+// flags adds the connection flags to the cobra command.
+func flags(cmd *cobra.Command) Params {
+	addr := cmd.Flags().StringP("address", "a", defaultAddr, "address of the OpenSlides manage service, host:port or unix:///path/to/socket")
 	defaultPasswordFile := path.Join(".", setup.SecretsDirName, setup.ManageAuthPasswordFileName)
-	passwordFile := cmd.Flags().String("password-file", defaultPasswordFile, "file with password for authorization to manage service, not usable in development mode")
+	passwordFile := cmd.Flags().String("password-file", defaultPasswordFile, "password for authorization to manage service as file or URI (env://NAME, keystore:///path#name, https://...), not usable in development mode")
 	noSSL := cmd.Flags().Bool("no-ssl", false, "use an unencrypted connection to manage service")
 	timeout := cmd.Flags().DurationP("timeout", "t", defaultTimeout, "time to wait for the command's response")
+
+	caFileHelpText := "file with PEM encoded CA certificates to verify the manage service, " +
+		"defaults to the system pool and the certificate created by the setup command"
+	caFile := cmd.Flags().String("ca-file", "", caFileHelpText)
+	serverName := cmd.Flags().String("server-name", "", "server name to verify the certificate of the manage service, defaults to the host of the address")
+	clientCert := cmd.Flags().String("client-cert", "", "file with PEM encoded client certificate for mutual TLS")
+	clientKey := cmd.Flags().String("client-key", "", "file with PEM encoded client key for mutual TLS")
+	insecureSkipVerify := cmd.Flags().Bool("insecure-skip-verify", false, "do not verify the certificate of the manage service (insecure)")
+
 	return Params{
-		Addr:         addr,
-		PasswordFile: passwordFile,
-		NoSSL:        noSSL,
-		Timeout:      timeout,
+		Addr:               addr,
+		PasswordFile:       passwordFile,
+		NoSSL:              noSSL,
+		Timeout:            timeout,
+		CAFile:             caFile,
+		ServerName:         serverName,
+		ClientCert:         clientCert,
+		ClientKey:          clientKey,
+		InsecureSkipVerify: insecureSkipVerify,
 	}
 }
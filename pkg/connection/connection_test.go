@@ -1,7 +1,484 @@
 package connection_test
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
 
 func TestDial(t *testing.T) {
 	t.Skip("test is missing here")
 }
+
+func params(t testing.TB, args ...string) connection.Params {
+	t.Helper()
+	cmd := &cobra.Command{}
+	p := connection.Unary(cmd)
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatalf("parsing flags: %v", err)
+	}
+	return p
+}
+
+func TestTLSConfig(t *testing.T) {
+	t.Run("no SSL", func(t *testing.T) {
+		c, err := params(t, "--no-ssl").TLSConfig()
+		if err != nil {
+			t.Fatalf("creating TLS config: %v", err)
+		}
+		if c != nil {
+			t.Fatalf("TLS config should be nil with --no-ssl")
+		}
+	})
+
+	t.Run("verify by default", func(t *testing.T) {
+		c, err := params(t, "--server-name", "manage.example.com").TLSConfig()
+		if err != nil {
+			t.Fatalf("creating TLS config: %v", err)
+		}
+		if c.InsecureSkipVerify {
+			t.Fatalf("certificate verification should be enabled by default")
+		}
+		if c.ServerName != "manage.example.com" {
+			t.Fatalf("wrong server name, got %q", c.ServerName)
+		}
+	})
+
+	t.Run("insecure skip verify", func(t *testing.T) {
+		c, err := params(t, "--insecure-skip-verify").TLSConfig()
+		if err != nil {
+			t.Fatalf("creating TLS config: %v", err)
+		}
+		if !c.InsecureSkipVerify {
+			t.Fatalf("certificate verification should be disabled")
+		}
+	})
+
+	t.Run("invalid CA file", func(t *testing.T) {
+		caFile := path.Join(t.TempDir(), "ca.pem")
+		if err := os.WriteFile(caFile, []byte("no certificate"), 0600); err != nil {
+			t.Fatalf("writing CA file: %v", err)
+		}
+		_, err := params(t, "--ca-file", caFile).TLSConfig()
+		if err == nil || !strings.Contains(err.Error(), "no valid certificate") {
+			t.Fatalf("creating TLS config should fail with invalid CA file, got %v", err)
+		}
+	})
+
+	t.Run("invalid setup certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Mkdir(path.Join(dir, "secrets"), 0700); err != nil {
+			t.Fatalf("creating secrets directory: %v", err)
+		}
+		if err := os.WriteFile(path.Join(dir, "secrets", "cert_crt"), []byte("no certificate"), 0600); err != nil {
+			t.Fatalf("writing certificate file: %v", err)
+		}
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatalf("getting working directory: %v", err)
+		}
+		if err := os.Chdir(dir); err != nil {
+			t.Fatalf("changing working directory: %v", err)
+		}
+		defer os.Chdir(wd)
+
+		_, err = params(t).TLSConfig()
+		if err == nil || !strings.Contains(err.Error(), "no valid certificate") {
+			t.Fatalf("creating TLS config should fail with invalid setup certificate, got %v", err)
+		}
+	})
+
+	t.Run("client certificate without key", func(t *testing.T) {
+		if _, err := params(t, "--client-cert", "client.pem").TLSConfig(); err == nil {
+			t.Fatalf("creating TLS config should fail without client key")
+		}
+	})
+}
+
+func TestDialInvalidUnixAddress(t *testing.T) {
+	pwFile := path.Join(t.TempDir(), "password")
+	if err := os.WriteFile(pwFile, []byte("password"), 0600); err != nil {
+		t.Fatalf("writing password file: %v", err)
+	}
+
+	_, _, err := connection.Dial(context.Background(), "unix://run/manage.sock", pwFile, nil)
+	if err == nil {
+		t.Fatalf("dialing relative socket path should fail but it didn't")
+	}
+	var errExit interface {
+		ExitCode() int
+	}
+	if !errors.As(err, &errExit) || errExit.ExitCode() != fehler.ExitValidation {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
+
+func TestDialUnknownCertificate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.EnableHTTP2 = true
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	pwFile := path.Join(t.TempDir(), "password")
+	if err := os.WriteFile(pwFile, []byte("password"), 0600); err != nil {
+		t.Fatalf("writing password file: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, _, err := connection.Dial(ctx, srv.Listener.Addr().String(), pwFile, &tls.Config{MinVersion: tls.VersionTLS12})
+	if err == nil {
+		t.Fatalf("dialing server with unknown certificate should fail but it didn't")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("dialing took %s, the error should be returned at once", time.Since(start))
+	}
+	var errExit interface {
+		ExitCode() int
+	}
+	if !errors.As(err, &errExit) || errExit.ExitCode() != fehler.ExitConnection {
+		t.Fatalf("expected connection error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("error should mention the certificate, got %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	configFile := path.Join(t.TempDir(), "config.yml")
+	config := `
+current_context: berlin
+contexts:
+  - name: berlin
+    address: berlin.example.org:9008
+    no_ssl: true
+    timeout: 1m
+  - name: hamburg
+    address: hamburg.example.org:9008
+`
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	t.Setenv(connection.ConfigEnv, configFile)
+
+	resolve := func(t *testing.T, args ...string) (connection.Params, error) {
+		t.Helper()
+		cmd := &cobra.Command{}
+		p := connection.Unary(cmd)
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatalf("parsing flags: %v", err)
+		}
+		return p, p.Resolve(cmd)
+	}
+
+	t.Run("current context", func(t *testing.T) {
+		p, err := resolve(t)
+		if err != nil {
+			t.Fatalf("resolving params: %v", err)
+		}
+		if *p.Addr != "berlin.example.org:9008" || !*p.NoSSL || p.Timeout.String() != "1m0s" {
+			t.Fatalf("wrong params, got address %q, no-ssl %t, timeout %s", *p.Addr, *p.NoSSL, *p.Timeout)
+		}
+	})
+
+	t.Run("context flag", func(t *testing.T) {
+		p, err := resolve(t, "--context", "hamburg")
+		if err != nil {
+			t.Fatalf("resolving params: %v", err)
+		}
+		if *p.Addr != "hamburg.example.org:9008" || *p.NoSSL {
+			t.Fatalf("wrong params, got address %q, no-ssl %t", *p.Addr, *p.NoSSL)
+		}
+	})
+
+	t.Run("environment overrides context", func(t *testing.T) {
+		t.Setenv("OPENSLIDES_ADDRESS", "env.example.org:9008")
+		t.Setenv("OPENSLIDES_NO_SSL", "false")
+		p, err := resolve(t)
+		if err != nil {
+			t.Fatalf("resolving params: %v", err)
+		}
+		if *p.Addr != "env.example.org:9008" || *p.NoSSL {
+			t.Fatalf("wrong params, got address %q, no-ssl %t", *p.Addr, *p.NoSSL)
+		}
+	})
+
+	t.Run("context flag overrides environment", func(t *testing.T) {
+		t.Setenv("OPENSLIDES_ADDRESS", "env.example.org:9008")
+		t.Setenv("OPENSLIDES_TIMEOUT", "2m")
+		p, err := resolve(t, "--context", "hamburg")
+		if err != nil {
+			t.Fatalf("resolving params: %v", err)
+		}
+		if *p.Addr != "hamburg.example.org:9008" {
+			t.Fatalf("wrong address, got %q", *p.Addr)
+		}
+		if p.Timeout.String() != "2m0s" {
+			t.Fatalf("environment should be used for values missing in the context, got timeout %s", *p.Timeout)
+		}
+	})
+
+	t.Run("flag overrides environment", func(t *testing.T) {
+		t.Setenv("OPENSLIDES_ADDRESS", "env.example.org:9008")
+		p, err := resolve(t, "--address", "flag.example.org:9008")
+		if err != nil {
+			t.Fatalf("resolving params: %v", err)
+		}
+		if *p.Addr != "flag.example.org:9008" {
+			t.Fatalf("wrong address, got %q", *p.Addr)
+		}
+	})
+
+	t.Run("unknown context", func(t *testing.T) {
+		t.Setenv(connection.ContextEnv, "munich")
+		_, err := resolve(t)
+		var errExit interface{ ExitCode() int }
+		if !errors.As(err, &errExit) || errExit.ExitCode() != fehler.ExitValidation {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+	})
+
+	t.Run("invalid environment value", func(t *testing.T) {
+		t.Setenv("OPENSLIDES_TIMEOUT", "soon")
+		if _, err := resolve(t); err == nil {
+			t.Fatalf("resolving invalid timeout should fail but it didn't")
+		}
+	})
+}
+
+func TestContextCmd(t *testing.T) {
+	configFile := path.Join(t.TempDir(), "openslides", "config.yml")
+	t.Setenv(connection.ConfigEnv, configFile)
+
+	run := func(t *testing.T, args ...string) error {
+		t.Helper()
+		cmd := connection.ContextCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(io.Discard)
+		return cmd.Execute()
+	}
+
+	if err := run(t, "set", "berlin", "--address", "berlin.example.org:9008", "--no-ssl"); err != nil {
+		t.Fatalf("setting context: %v", err)
+	}
+	if err := run(t, "set", "hamburg", "--address", "hamburg.example.org:9008"); err != nil {
+		t.Fatalf("setting context: %v", err)
+	}
+	if err := run(t, "use", "hamburg"); err != nil {
+		t.Fatalf("using context: %v", err)
+	}
+	if err := run(t, "use", "munich"); err == nil {
+		t.Fatalf("using unknown context should fail but it didn't")
+	}
+
+	c, err := connection.LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if c.CurrentContext != "hamburg" || len(c.Contexts) != 2 {
+		t.Fatalf("wrong config, got current context %q and %d contexts", c.CurrentContext, len(c.Contexts))
+	}
+	berlin := c.Context("berlin")
+	if berlin.Address != "berlin.example.org:9008" || berlin.NoSSL == nil || !*berlin.NoSSL || berlin.PasswordFile != "" {
+		t.Fatalf("wrong context berlin: %+v", berlin)
+	}
+
+	if err := run(t, "delete", "hamburg"); err != nil {
+		t.Fatalf("deleting context: %v", err)
+	}
+	c, err = connection.LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if c.CurrentContext != "" || len(c.Contexts) != 1 {
+		t.Fatalf("wrong config after delete, got current context %q and %d contexts", c.CurrentContext, len(c.Contexts))
+	}
+}
+
+func TestFleet(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	srv := grpc.NewServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	dir := t.TempDir()
+	pwFile := path.Join(dir, "password")
+	if err := os.WriteFile(pwFile, []byte("password"), 0600); err != nil {
+		t.Fatalf("writing password file: %v", err)
+	}
+	configFile := path.Join(dir, "config.yml")
+	config := fmt.Sprintf(`
+current_context: berlin
+contexts:
+  - name: berlin
+    address: %[1]s
+    password_file: %[2]s
+    no_ssl: true
+  - name: hamburg
+    address: %[1]s
+    password_file: %[2]s
+    no_ssl: true
+  - name: broken
+    address: unix://run/manage.sock
+    password_file: %[2]s
+    no_ssl: true
+`, lis.Addr().String(), pwFile)
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	t.Setenv(connection.ConfigEnv, configFile)
+
+	run := func(t *testing.T, format string, args ...string) (string, error) {
+		t.Helper()
+		cmd := &cobra.Command{Use: "test", Args: cobra.NoArgs}
+		cp := connection.Unary(cmd)
+		fl := connection.Multi(cmd, cp)
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			if !fl.Enabled() {
+				return fmt.Errorf("fleet mode is not enabled")
+			}
+			return fl.Run(cmd, func(ctx context.Context, cl proto.ManageClient, p connection.Params) error {
+				pr := output.FromContext(ctx)
+				pr.Printf("connected\n")
+				return pr.Result(map[string]string{"address": *p.Addr})
+			})
+		}
+		cmd.SetArgs(args)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+
+		buf := new(bytes.Buffer)
+		p, _ := output.New(buf, format)
+		err := cmd.ExecuteContext(output.NewContext(context.Background(), p))
+		return buf.String(), err
+	}
+
+	exitCode := func(err error) int {
+		var errExit interface{ ExitCode() int }
+		if !errors.As(err, &errExit) {
+			return 0
+		}
+		return errExit.ExitCode()
+	}
+
+	t.Run("all contexts succeed", func(t *testing.T) {
+		out, err := run(t, output.FormatText, "--contexts", "berlin,hamburg", "--parallel", "1")
+		if err != nil {
+			t.Fatalf("running command: %v", err)
+		}
+		expected := "[berlin] connected\n[hamburg] connected\n2 of 2 instances succeeded.\n"
+		if out != expected {
+			t.Fatalf("wrong output, expected %q, got %q", expected, out)
+		}
+	})
+
+	t.Run("partial success", func(t *testing.T) {
+		out, err := run(t, output.FormatText, "--all-contexts")
+		if code := exitCode(err); code != fehler.ExitPartialSuccess {
+			t.Fatalf("expected exit code %d, got %d (%v)", fehler.ExitPartialSuccess, code, err)
+		}
+		if !strings.Contains(out, "[broken] Error: ") || !strings.Contains(out, "2 of 3 instances succeeded.") {
+			t.Fatalf("wrong output, got %q", out)
+		}
+	})
+
+	t.Run("partial success in JSON", func(t *testing.T) {
+		out, err := run(t, output.FormatJSON, "--all-contexts")
+		if !output.IsReported(err) || exitCode(err) != fehler.ExitPartialSuccess {
+			t.Fatalf("expected reported partial success, got %v", err)
+		}
+		var got struct {
+			OK     bool `json:"ok"`
+			Result struct {
+				Instances []struct {
+					Context string `json:"context"`
+					OK      bool   `json:"ok"`
+					Result  struct {
+						Address string `json:"address"`
+					} `json:"result"`
+					Error struct {
+						ExitCode int `json:"exit_code"`
+					} `json:"error"`
+				} `json:"instances"`
+			} `json:"result"`
+			Error struct {
+				ExitCode int `json:"exit_code"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+		}
+		if got.OK || got.Error.ExitCode != fehler.ExitPartialSuccess || len(got.Result.Instances) != 3 {
+			t.Fatalf("wrong report: %s", out)
+		}
+		berlin, broken := got.Result.Instances[0], got.Result.Instances[2]
+		if !berlin.OK || berlin.Result.Address != lis.Addr().String() {
+			t.Fatalf("wrong result for berlin: %s", out)
+		}
+		if broken.OK || broken.Error.ExitCode != fehler.ExitValidation {
+			t.Fatalf("wrong result for broken: %s", out)
+		}
+	})
+
+	t.Run("all contexts fail", func(t *testing.T) {
+		_, err := run(t, output.FormatText, "--contexts", "broken")
+		if code := exitCode(err); code != fehler.ExitValidation {
+			t.Fatalf("expected exit code %d, got %d (%v)", fehler.ExitValidation, code, err)
+		}
+	})
+
+	t.Run("timeout for all contexts", func(t *testing.T) {
+		if _, err := run(t, output.FormatText, "--contexts", "berlin", "--timeout", "5s"); err != nil {
+			t.Fatalf("running command: %v", err)
+		}
+	})
+
+	t.Run("environment override", func(t *testing.T) {
+		t.Setenv("OPENSLIDES_ADDRESS", lis.Addr().String())
+		_, err := run(t, output.FormatText, "--all-contexts")
+		if code := exitCode(err); code != fehler.ExitValidation {
+			t.Fatalf("expected exit code %d, got %d (%v)", fehler.ExitValidation, code, err)
+		}
+	})
+
+	t.Run("invalid flags", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--all-contexts", "--contexts", "berlin"},
+			{"--contexts", "berlin", "--context", "hamburg"},
+			{"--contexts", "berlin", "--parallel", "0"},
+			{"--contexts", "munich"},
+			{"--all-contexts", "--address", "berlin.example.org:9008"},
+			{"--contexts", "berlin", "--password-file", "env://PASSWORD"},
+		} {
+			_, err := run(t, output.FormatText, args...)
+			if code := exitCode(err); code != fehler.ExitValidation {
+				t.Fatalf("%v: expected exit code %d, got %d (%v)", args, fehler.ExitValidation, code, err)
+			}
+		}
+	})
+}
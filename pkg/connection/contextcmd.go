@@ -0,0 +1,225 @@
+package connection
+
+import (
+	"fmt"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// ContextHelp contains the short help text for the command.
+	ContextHelp = "Manages the connection contexts of the client config file"
+
+	// ContextHelpExtra contains the long help text for the command without
+	// the headline.
+	ContextHelpExtra = `A context is a named set of connection parameters like address, password
+file or URI, TLS settings and timeout. They are stored in the client config
+file ~/.config/openslides/config.yml (or the file in OPENSLIDES_CONFIG).
+
+All commands that connect to the manage service use the current context or the
+context given with --context or OPENSLIDES_CONTEXT. Flags given on the command
+line take precedence, followed by environment variables like
+OPENSLIDES_ADDRESS, OPENSLIDES_PASSWORD_FILE, OPENSLIDES_NO_SSL or
+OPENSLIDES_TIMEOUT. A context given with --context takes precedence over these
+environment variables.`
+)
+
+// ContextCmd returns the subcommand.
+func ContextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "context",
+		Short: ContextHelp,
+		Long:  ContextHelp + "\n\n" + ContextHelpExtra,
+	}
+	cmd.AddCommand(
+		contextListCmd(),
+		contextCurrentCmd(),
+		contextUseCmd(),
+		contextSetCmd(),
+		contextDeleteCmd(),
+	)
+	return cmd
+}
+
+func contextListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Prints all contexts, the current one is marked with *",
+		Args:  cobra.NoArgs,
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		_, c, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		p := output.FromContext(cmd.Context())
+		for _, profile := range c.Contexts {
+			mark := " "
+			if profile.Name == c.CurrentContext {
+				mark = "*"
+			}
+			address := profile.Address
+			if address == "" {
+				address = defaultAddr
+			}
+			p.Printf("%s %s\t%s\n", mark, profile.Name, address)
+		}
+		return p.Result(c)
+	}
+	return cmd
+}
+
+func contextCurrentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "current",
+		Short: "Prints the name of the current context",
+		Args:  cobra.NoArgs,
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		_, c, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if c.CurrentContext == "" {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("no current context set"))
+		}
+		p := output.FromContext(cmd.Context())
+		p.Printf("%s\n", c.CurrentContext)
+		return p.Result(map[string]string{"current_context": c.CurrentContext})
+	}
+	return cmd
+}
+
+func contextUseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "use name",
+		Short: "Sets the current context",
+		Args:  cobra.ExactArgs(1),
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		filename, c, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		name := args[0]
+		if c.Context(name) == nil {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("context %q does not exist in %s", name, filename))
+		}
+		c.CurrentContext = name
+		if err := c.Write(filename); err != nil {
+			return err
+		}
+		p := output.FromContext(cmd.Context())
+		p.Printf("Switched to context %q.\n", name)
+		return p.Result(map[string]string{"current_context": name})
+	}
+	return cmd
+}
+
+func contextSetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set name",
+		Short: "Creates or updates a context with the given connection flags",
+		Long: `Creates or updates a context with the given connection flags. Only flags
+given on the command line are changed. The first context becomes the current
+context.`,
+		Args: cobra.ExactArgs(1),
+	}
+	flags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		filename, c, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		name := args[0]
+		profile := c.Context(name)
+		if profile == nil {
+			profile = &Profile{Name: name}
+			c.Contexts = append(c.Contexts, profile)
+		}
+
+		fs := cmd.Flags()
+		str := func(flag string, v *string) {
+			if fs.Changed(flag) {
+				*v = fs.Lookup(flag).Value.String()
+			}
+		}
+		boolean := func(flag string, v **bool) {
+			if fs.Changed(flag) {
+				b, _ := fs.GetBool(flag) // The flag is always defined.
+				*v = &b
+			}
+		}
+		str("address", &profile.Address)
+		str("password-file", &profile.PasswordFile)
+		str("timeout", &profile.Timeout)
+		str("ca-file", &profile.CAFile)
+		str("server-name", &profile.ServerName)
+		str("client-cert", &profile.ClientCert)
+		str("client-key", &profile.ClientKey)
+		boolean("no-ssl", &profile.NoSSL)
+		boolean("insecure-skip-verify", &profile.InsecureSkipVerify)
+
+		if c.CurrentContext == "" {
+			c.CurrentContext = name
+		}
+		if err := c.Write(filename); err != nil {
+			return err
+		}
+		p := output.FromContext(cmd.Context())
+		p.Printf("Context %q saved in %s.\n", name, filename)
+		return p.Result(profile)
+	}
+	return cmd
+}
+
+func contextDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete name",
+		Short: "Deletes a context",
+		Args:  cobra.ExactArgs(1),
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		filename, c, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		name := args[0]
+		if c.Context(name) == nil {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("context %q does not exist in %s", name, filename))
+		}
+		contexts := c.Contexts[:0]
+		for _, profile := range c.Contexts {
+			if profile.Name != name {
+				contexts = append(contexts, profile)
+			}
+		}
+		c.Contexts = contexts
+		if c.CurrentContext == name {
+			c.CurrentContext = ""
+		}
+		if err := c.Write(filename); err != nil {
+			return err
+		}
+		p := output.FromContext(cmd.Context())
+		p.Printf("Context %q deleted.\n", name)
+		return p.Result(map[string]string{"deleted": name})
+	}
+	return cmd
+}
+
+// loadConfig returns the path and the content of the client config file.
+func loadConfig() (string, *ClientConfig, error) {
+	filename, err := ConfigPath()
+	if err != nil {
+		return "", nil, err
+	}
+	c, err := LoadConfig(filename)
+	if err != nil {
+		return "", nil, fehler.ExitCode(fehler.ExitValidation, err)
+	}
+	return filename, c, nil
+}
@@ -0,0 +1,266 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"github.com/spf13/cobra"
+)
+
+// defaultParallel is the default number of instances that are called at the
+// same time in fleet mode.
+const defaultParallel = 8
+
+// timeoutFlag is the only connection flag that can be given in fleet mode.
+const timeoutFlag = "timeout"
+
+// RunFunc is called by Fleet.Run for every instance with a connected client
+// and the resolved parameters of the instance. The context carries the
+// timeout and the printer of the instance.
+type RunFunc func(ctx context.Context, cl proto.ManageClient, p Params) error
+
+// Fleet provides the flags to run a command against many contexts.
+type Fleet struct {
+	All      *bool
+	Contexts *[]string
+	Parallel *int
+}
+
+// Multi adds the flags --all-contexts, --contexts and --parallel to a command
+// that uses the connection parameters p from Unary. In fleet mode the
+// parameters of every context are taken from the context only. Connection
+// flags and OPENSLIDES_* environment variables are rejected, else all
+// instances would be called at the same address. Only the timeout can be
+// given for all contexts.
+func Multi(cmd *cobra.Command, p Params) Fleet {
+	f := Fleet{
+		All:      cmd.Flags().Bool("all-contexts", false, "run the command against all contexts of the client config file"),
+		Contexts: cmd.Flags().StringSlice("contexts", nil, "comma separated contexts to run the command against"),
+		Parallel: cmd.Flags().Int("parallel", defaultParallel, "number of instances that are called at the same time in fleet mode"),
+	}
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if !f.Enabled() {
+			return p.Resolve(cmd)
+		}
+		if *f.All && len(*f.Contexts) > 0 {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("--all-contexts and --contexts can not be used together"))
+		}
+		if cmd.Flags().Changed(contextFlag) {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("--context can not be used together with --all-contexts or --contexts"))
+		}
+		if *f.Parallel < 1 {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("--parallel has to be at least 1"))
+		}
+		for _, name := range connectionFlags {
+			if name == timeoutFlag {
+				continue
+			}
+			if cmd.Flags().Changed(name) {
+				return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("--%s can not be used together with --all-contexts or --contexts, set it in the contexts", name))
+			}
+			if env := envName(name); os.Getenv(env) != "" {
+				return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("environment variable %s can not be used together with --all-contexts or --contexts, set it in the contexts", env))
+			}
+		}
+		return nil
+	}
+	return f
+}
+
+// Enabled returns true if the command should run against many contexts.
+func (f Fleet) Enabled() bool {
+	return *f.All || len(*f.Contexts) > 0
+}
+
+// instance is the result of the command for one context.
+type instance struct {
+	Context string          `json:"context"`
+	Address string          `json:"address,omitempty"`
+	OK      bool            `json:"ok"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+
+	out []byte
+	err error
+}
+
+// Run calls fn for all selected contexts with at most --parallel calls at the
+// same time and prints a combined report. In text format every line of an
+// instance is prefixed with its context name. In JSON format the result is a
+// list of the results of all instances.
+//
+// If some instances fail, the error has the exit code for partial success. If
+// all fail, the exit code of the first failure is used.
+func (f Fleet) Run(cmd *cobra.Command, fn RunFunc) error {
+	profiles, err := f.profiles()
+	if err != nil {
+		return err
+	}
+
+	p := output.FromContext(cmd.Context())
+	instances := make([]*instance, len(profiles))
+	sem := make(chan struct{}, *f.Parallel)
+	var wg sync.WaitGroup
+	for i, profile := range profiles {
+		wg.Add(1)
+		go func(i int, profile *Profile) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			instances[i] = runInstance(cmd, profile, p.JSON(), fn)
+		}(i, profile)
+	}
+	wg.Wait()
+
+	var failed []*instance
+	for _, inst := range instances {
+		prefix := fmt.Sprintf("[%s] ", inst.Context)
+		for _, line := range strings.Split(strings.TrimSuffix(string(inst.out), "\n"), "\n") {
+			if line != "" {
+				p.Printf("%s%s\n", prefix, line)
+			}
+		}
+		if inst.err != nil {
+			failed = append(failed, inst)
+			p.Printf("%sError: %v\n", prefix, inst.err)
+		}
+	}
+	p.Printf("%d of %d instances succeeded.\n", len(instances)-len(failed), len(instances))
+
+	report := map[string]interface{}{"instances": instances}
+	if len(failed) == 0 {
+		return p.Result(report)
+	}
+
+	code := fehler.ExitPartialSuccess
+	if len(failed) == len(instances) {
+		code = exitCodeOf(failed[0].err)
+	}
+	names := make([]string, len(failed))
+	for i, inst := range failed {
+		names[i] = inst.Context
+	}
+	err = fehler.ExitCode(code, fmt.Errorf("%d of %d instances failed: %s", len(failed), len(instances), strings.Join(names, ", ")))
+	if pErr := p.Partial(report, err, code); pErr != nil {
+		return err
+	}
+	return output.Reported(err)
+}
+
+// profiles returns the selected contexts.
+func (f Fleet) profiles() ([]*Profile, error) {
+	filename, c, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if *f.All {
+		if len(c.Contexts) == 0 {
+			return nil, fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("no contexts in %s", filename))
+		}
+		return c.Contexts, nil
+	}
+
+	var profiles []*Profile
+	seen := make(map[string]bool)
+	for _, name := range *f.Contexts {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		profile := c.Context(name)
+		if profile == nil {
+			return nil, fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("context %q does not exist in %s", name, filename))
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// runInstance runs fn for one context. The output is written into a buffer
+// in the given format.
+func runInstance(cmd *cobra.Command, profile *Profile, jsonFormat bool, fn RunFunc) *instance {
+	inst := &instance{Context: profile.Name}
+
+	format := output.FormatText
+	if jsonFormat {
+		format = output.FormatJSON
+	}
+	buf := new(bytes.Buffer)
+	ip, _ := output.New(buf, format) // The format is always valid.
+
+	inst.err = func() error {
+		params, err := paramsFor(cmd, profile)
+		if err != nil {
+			return err
+		}
+		inst.Address = *params.Addr
+
+		ctx, cancel := context.WithTimeout(output.NewContext(cmd.Context(), ip), *params.Timeout)
+		defer cancel()
+
+		cl, close, err := params.Dial(ctx)
+		if err != nil {
+			return fmt.Errorf("connecting to gRPC server: %w", err)
+		}
+		defer close()
+
+		return fn(ctx, cl, params)
+	}()
+	inst.OK = inst.err == nil
+
+	if !jsonFormat {
+		inst.out = buf.Bytes()
+		return inst
+	}
+	if inst.err != nil {
+		buf.Reset()
+		ip.Error(inst.err, exitCodeOf(inst.err))
+	}
+	var doc struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err == nil {
+		inst.Result = doc.Result
+		inst.Error = doc.Error
+	}
+	return inst
+}
+
+// paramsFor returns the connection parameters for the context. A timeout
+// given on the command line takes precedence.
+func paramsFor(cmd *cobra.Command, profile *Profile) (Params, error) {
+	c := &cobra.Command{}
+	p := flags(c)
+	if cmd.Flags().Changed(timeoutFlag) {
+		if err := c.Flags().Set(timeoutFlag, cmd.Flags().Lookup(timeoutFlag).Value.String()); err != nil {
+			return Params{}, fmt.Errorf("copying flag %s: %w", timeoutFlag, err)
+		}
+	}
+	if err := resolve(c, profile, true); err != nil {
+		return Params{}, err
+	}
+	return p, nil
+}
+
+// exitCodeOf returns the exit code attached to the error or the general exit
+// code.
+func exitCodeOf(err error) int {
+	var errExit interface {
+		ExitCode() int
+	}
+	if errors.As(err, &errExit) && errExit.ExitCode() > 0 {
+		return errExit.ExitCode()
+	}
+	return fehler.ExitGeneral
+}
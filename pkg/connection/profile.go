@@ -0,0 +1,256 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// ConfigEnv is the environment variable with the path of the client config
+	// file.
+	ConfigEnv = "OPENSLIDES_CONFIG"
+
+	// ContextEnv is the environment variable with the name of the context to
+	// use instead of the current context of the config file.
+	ContextEnv = "OPENSLIDES_CONTEXT"
+
+	// envPrefix is the prefix of the environment variables that override the
+	// connection flags, e. g. OPENSLIDES_ADDRESS for --address.
+	envPrefix = "OPENSLIDES_"
+
+	contextFlag = "context"
+)
+
+// connectionFlags are the flags of Unary that can be set by a context or an
+// environment variable.
+var connectionFlags = []string{
+	"address",
+	"password-file",
+	"no-ssl",
+	"timeout",
+	"ca-file",
+	"server-name",
+	"client-cert",
+	"client-key",
+	"insecure-skip-verify",
+}
+
+// ClientConfig is the content of the client config file. Example:
+//
+//	current_context: prod-berlin
+//	contexts:
+//	  - name: prod-berlin
+//	    address: manage.berlin.example.org:9008
+//	    password_file: keystore:///home/admin/keystore.json#berlin
+//	    ca_file: /etc/openslides/ca.pem
+//	    timeout: 1m
+//	  - name: local
+//	    address: localhost:9008
+//	    password_file: /srv/openslides/secrets/manage_auth_password
+//	    no_ssl: true
+type ClientConfig struct {
+	CurrentContext string     `json:"current_context,omitempty"`
+	Contexts       []*Profile `json:"contexts"`
+}
+
+// Profile holds the connection parameters of a context. Empty values are not
+// used, so the defaults of the flags apply.
+type Profile struct {
+	Name               string `json:"name"`
+	Address            string `json:"address,omitempty"`
+	PasswordFile       string `json:"password_file,omitempty"`
+	NoSSL              *bool  `json:"no_ssl,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	CAFile             string `json:"ca_file,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	ClientCert         string `json:"client_cert,omitempty"`
+	ClientKey          string `json:"client_key,omitempty"`
+	InsecureSkipVerify *bool  `json:"insecure_skip_verify,omitempty"`
+}
+
+// flagValues returns the values of the profile by flag name.
+func (p *Profile) flagValues() map[string]string {
+	values := map[string]string{
+		"address":       p.Address,
+		"password-file": p.PasswordFile,
+		"timeout":       p.Timeout,
+		"ca-file":       p.CAFile,
+		"server-name":   p.ServerName,
+		"client-cert":   p.ClientCert,
+		"client-key":    p.ClientKey,
+	}
+	if p.NoSSL != nil {
+		values["no-ssl"] = strconv.FormatBool(*p.NoSSL)
+	}
+	if p.InsecureSkipVerify != nil {
+		values["insecure-skip-verify"] = strconv.FormatBool(*p.InsecureSkipVerify)
+	}
+	for k, v := range values {
+		if v == "" {
+			delete(values, k)
+		}
+	}
+	return values
+}
+
+// ConfigPath returns the path of the client config file. It is taken from
+// OPENSLIDES_CONFIG and defaults to openslides/config.yml in the user's config
+// directory, e. g. ~/.config/openslides/config.yml.
+func ConfigPath() (string, error) {
+	if p := os.Getenv(ConfigEnv); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("getting user config directory: %w", err)
+	}
+	return path.Join(dir, "openslides", "config.yml"), nil
+}
+
+// LoadConfig reads the client config file. A missing file results in an empty
+// config.
+func LoadConfig(filename string) (*ClientConfig, error) {
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return &ClientConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading client config file: %w", err)
+	}
+	var c ClientConfig
+	if err := yaml.Unmarshal(content, &c); err != nil {
+		return nil, fmt.Errorf("unmarshalling client config file %q: %w", filename, err)
+	}
+
+	names := make(map[string]bool)
+	for i, p := range c.Contexts {
+		if p == nil || p.Name == "" {
+			return nil, fmt.Errorf("client config file %q: context %d has no name", filename, i+1)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("client config file %q: context %q is defined more than once", filename, p.Name)
+		}
+		names[p.Name] = true
+	}
+	return &c, nil
+}
+
+// Write writes the client config file. The directory is created if it does
+// not exist.
+func (c *ClientConfig) Write(filename string) error {
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("marshalling client config: %w", err)
+	}
+	if err := os.MkdirAll(path.Dir(filename), 0700); err != nil {
+		return fmt.Errorf("creating directory for client config file: %w", err)
+	}
+	if err := os.WriteFile(filename, content, 0600); err != nil {
+		return fmt.Errorf("writing client config file: %w", err)
+	}
+	return nil
+}
+
+// Context returns the context with the given name or nil if it does not
+// exist.
+func (c *ClientConfig) Context(name string) *Profile {
+	for _, p := range c.Contexts {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Resolve sets all connection flags that are not given on the command line.
+// The values are taken from the environment variables OPENSLIDES_ADDRESS,
+// OPENSLIDES_PASSWORD_FILE and so on or from the context. The context is given
+// with --context, OPENSLIDES_CONTEXT or as current context of the client
+// config file.
+//
+// A context given with --context takes precedence over the environment
+// variables, so a chosen context is never redirected by the environment.
+func (p Params) Resolve(cmd *cobra.Command) error {
+	profile, err := p.profile(cmd)
+	if err != nil {
+		return err
+	}
+	return resolve(cmd, profile, cmd.Flags().Changed(contextFlag))
+}
+
+// resolve sets all connection flags of the command that are not given on the
+// command line from the environment or the profile. The profile may be nil. If
+// profileFirst is true, the values of the profile take precedence over the
+// environment.
+func resolve(cmd *cobra.Command, profile *Profile, profileFirst bool) error {
+	var values map[string]string
+	if profile != nil {
+		values = profile.flagValues()
+	}
+
+	for _, name := range connectionFlags {
+		if cmd.Flags().Changed(name) {
+			continue
+		}
+		env := envName(name)
+		source := "environment variable " + env
+		value := os.Getenv(env)
+		if v, ok := values[name]; ok && (value == "" || profileFirst) {
+			value = v
+			source = fmt.Sprintf("context %q", profile.Name)
+		}
+		if value == "" {
+			continue
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("invalid value %q for %s from %s: %w", value, name, source, err))
+		}
+	}
+	return nil
+}
+
+// envName returns the environment variable for the connection flag.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// profile returns the selected context or nil if no context is selected.
+func (p Params) profile(cmd *cobra.Command) (*Profile, error) {
+	name := *p.Context
+	if !cmd.Flags().Changed(contextFlag) {
+		name = os.Getenv(ContextEnv)
+	}
+
+	filename, err := ConfigPath()
+	if err != nil {
+		if name == "" {
+			// Without config directory there is no current context.
+			return nil, nil
+		}
+		return nil, err
+	}
+	c, err := LoadConfig(filename)
+	if err != nil {
+		return nil, fehler.ExitCode(fehler.ExitValidation, err)
+	}
+
+	if name == "" {
+		name = c.CurrentContext
+	}
+	if name == "" {
+		return nil, nil
+	}
+	profile := c.Context(name)
+	if profile == nil {
+		return nil, fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("context %q does not exist in %s", name, filename))
+	}
+	return profile, nil
+}
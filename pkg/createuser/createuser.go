@@ -7,12 +7,14 @@ import (
 	"strings"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
 	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/codes"
 )
 
 const (
@@ -50,10 +52,10 @@ func Cmd() *cobra.Command {
 			return fmt.Errorf("reading user data from positional argument or file or stdin: %w", err)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := cp.Dial(ctx)
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -78,29 +80,28 @@ func Run(ctx context.Context, gc gRPCClient, userData []byte) error {
 
 	in := &proto.CreateUserRequest{}
 	if err := yaml.Unmarshal(userData, in); err != nil {
-		return fmt.Errorf("unmarshalling user data: %w", err)
+		return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("unmarshalling user data: %w", err))
 	}
 
 	if in.Username == "" {
-		return fmt.Errorf("missing username in user data")
+		return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("missing username in user data"))
 	}
 	if in.DefaultPassword == "" {
-		return fmt.Errorf("missing default_password in user data")
+		return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("missing default_password in user data"))
 	}
 	if in.OrganizationManagementLevel != "" {
 		if err := checkOrganizationManagementLevel(in.OrganizationManagementLevel); err != nil {
-			return fmt.Errorf("wrong value for organization_management_level in user data: %w", err)
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("wrong value for organization_management_level in user data: %w", err))
 		}
 	}
 
 	resp, err := gc.CreateUser(ctx, in)
 	if err != nil {
-		s, _ := status.FromError(err) // The ok value does not matter here.
-		return fmt.Errorf("calling manage service: %s", s.Message())
+		return fmt.Errorf("calling manage service: %w", fehler.FromGRPC(err))
 	}
-	fmt.Printf("User %d created successfully.\n", resp.UserID)
-
-	return nil
+	p := output.FromContext(ctx)
+	p.Printf("User %d created successfully.\n", resp.UserID)
+	return p.Result(map[string]int64{"user_id": resp.UserID})
 }
 
 func checkOrganizationManagementLevel(v string) error {
@@ -122,6 +123,9 @@ type backendAction interface {
 // CreateUser creates the given user.
 // This function is the server side entrypoint for this package.
 func CreateUser(ctx context.Context, in *proto.CreateUserRequest, ba backendAction) (*proto.CreateUserResponse, error) {
+	if in.Username == "" {
+		return nil, fehler.WithCode(codes.InvalidArgument, fmt.Errorf("missing username"))
+	}
 	name := "user.create"
 	payload := []*proto.CreateUserRequest{in}
 	data, err := json.Marshal(payload)
@@ -7,13 +7,28 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/metrics"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/pkg/tracing"
 )
 
 const (
 	existsSubpath = "/exists"
 	getAllSubpath = "/get_all"
 	filterSubpath = "/filter"
+	healthSubpath = "/health"
+)
+
+var readerDuration = metrics.NewHistogram(
+	"openslides_manage_datastore_reader_request_duration_seconds",
+	"Latency of requests to the datastore reader by route and result.",
+	metrics.DefaultBuckets,
+	"route", "result",
 )
 
 // Conn holds a connection to the datastoreReader service.
@@ -83,29 +98,66 @@ func (d *Conn) GetAll(ctx context.Context, collection string, fields string) (st
 	return string(respData[:]), nil
 }
 
+// Health checks that the datastore reader is reachable and healthy.
+func (d *Conn) Health(ctx context.Context) error {
+	addr := d.readerURL.String() + healthSubpath
+	req, err := http.NewRequestWithContext(ctx, "GET", addr, nil)
+	if err != nil {
+		return fmt.Errorf("creating request to datastore: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request to datastore at %s: %w", addr, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fehler.WithCode(fehler.CodeFromHTTP(resp.StatusCode), fmt.Errorf("got response `%s`", resp.Status))
+	}
+	return nil
+}
+
 // sendReadRequest sends the given request body to the datastore.
-func sendReadRequest(ctx context.Context, addr string, reqBody string) ([]byte, error) {
+func sendReadRequest(ctx context.Context, addr string, reqBody string) (respBody []byte, err error) {
+	start := time.Now()
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		readerDuration.Observe(time.Since(start).Seconds(), path.Base(addr), result)
+	}()
+
+	ctx, span := tracing.Start(ctx, "HTTP POST", tracing.KindClient)
+	span.SetAttribute("http.method", "POST")
+	span.SetAttribute("http.url", addr)
+	defer func() { span.Finish(err) }()
+
 	req, err := http.NewRequestWithContext(ctx, "POST", addr, strings.NewReader(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("creating request to datastore: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, req.Header)
+	shared.InjectRequestID(ctx, req.Header)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("sending request to datastore at %s: %w", addr, err)
 	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			body = []byte("[can not read body]")
 		}
-		return nil, fmt.Errorf("got response `%s`: %s", resp.Status, body)
+		return nil, fehler.WithCode(fehler.CodeFromHTTP(resp.StatusCode), fmt.Errorf("got response `%s`: %s", resp.Status, body))
 	}
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err = io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("reading response body: %w", err)
 	}
@@ -1,5 +1,51 @@
 package fehler
 
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit codes of the openslides command. They are a stable contract for
+// scripts, so existing values must never change.
+const (
+	// ExitGeneral is used for all errors without a more specific exit code.
+	ExitGeneral = 1
+
+	// ExitInitialDataNotSet is used if initial data were not set because the
+	// datastore is not empty.
+	ExitInitialDataNotSet = 2
+
+	// ExitConnection is used if the manage service or one of the services
+	// behind it is not reachable.
+	ExitConnection = 3
+
+	// ExitAuthentication is used if the authentication at the manage service
+	// failed or the request is not permitted.
+	ExitAuthentication = 4
+
+	// ExitValidation is used if the request contains invalid data.
+	ExitValidation = 5
+
+	// ExitNotFound is used if a requested object or route does not exist.
+	ExitNotFound = 6
+
+	// ExitTimeout is used if the request did not finish in time.
+	ExitTimeout = 7
+
+	// ExitBackendRejected is used if the backend rejected an action, e. g.
+	// because of invalid payload or because the object already exists.
+	ExitBackendRejected = 8
+
+	// ExitPartialSuccess is used if a command with multiple requests failed
+	// after some requests were already applied.
+	ExitPartialSuccess = 9
+)
+
 // exitCodeError contains an error and an exit code. Such objects fulfill the
 // interface of wrapped errors.
 type exitCodeError struct {
@@ -26,3 +72,130 @@ func ExitCode(code int, err error) error {
 		code: code,
 	}
 }
+
+const (
+	// Domain is the domain of all error details attached to gRPC status
+	// errors by the manage server.
+	Domain = "openslides-manage-service"
+
+	// ReasonBackend marks error details of errors reported by the backend.
+	// The metadata contains the backend message and, if given, the action
+	// index and the action data index of the failing action.
+	ReasonBackend = "BACKEND_ERROR"
+)
+
+// grpcError contains a gRPC status returned by the manage server. Its error
+// message is built from the status details if possible.
+type grpcError struct {
+	status *status.Status
+}
+
+func (err grpcError) Error() string {
+	if info := err.backendInfo(); info != nil {
+		msg := "backend error: " + info.Metadata["message"]
+		var idx []string
+		if i, ok := info.Metadata["action_error_index"]; ok {
+			idx = append(idx, "failing action index "+i)
+		}
+		if i, ok := info.Metadata["action_data_error_index"]; ok {
+			idx = append(idx, "failing action data index "+i)
+		}
+		if len(idx) > 0 {
+			msg += fmt.Sprintf(" (%s)", strings.Join(idx, ", "))
+		}
+		return msg
+	}
+	return err.status.Message()
+}
+
+// backendInfo returns the error details of the backend or nil if the error
+// was not reported by the backend.
+func (err grpcError) backendInfo() *errdetails.ErrorInfo {
+	for _, d := range err.status.Details() {
+		info, ok := d.(*errdetails.ErrorInfo)
+		if ok && info.Domain == Domain && info.Reason == ReasonBackend {
+			return info
+		}
+	}
+	return nil
+}
+
+func (err grpcError) GRPCStatus() *status.Status {
+	return err.status
+}
+
+// ExitCode maps the status code to the exit code of the openslides command.
+func (err grpcError) ExitCode() int {
+	code := err.status.Code()
+	if err.backendInfo() != nil && code != codes.Unavailable && code != codes.NotFound && code != codes.DeadlineExceeded {
+		// The backend was reachable but did not accept the request.
+		return ExitBackendRejected
+	}
+	switch code {
+	case codes.Unavailable:
+		return ExitConnection
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return ExitAuthentication
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return ExitValidation
+	case codes.NotFound:
+		return ExitNotFound
+	case codes.DeadlineExceeded:
+		return ExitTimeout
+	default:
+		return ExitGeneral
+	}
+}
+
+// FromGRPC returns a readable error for an error returned by a gRPC call to the
+// manage server. The status of the error is kept.
+func FromGRPC(err error) error {
+	s, _ := status.FromError(err) // The ok value does not matter here.
+	return grpcError{status: s}
+}
+
+// codeError contains an error and a gRPC status code. The manage server uses
+// the code for its response.
+type codeError struct {
+	err  error
+	code codes.Code
+}
+
+func (err codeError) Error() string {
+	return err.err.Error()
+}
+
+func (err codeError) Unwrap() error {
+	return err.err
+}
+
+func (err codeError) GRPCStatus() *status.Status {
+	return status.New(err.code, err.err.Error())
+}
+
+// WithCode returns a new error with attached gRPC status code.
+func WithCode(code codes.Code, err error) error {
+	return codeError{
+		err:  err,
+		code: code,
+	}
+}
+
+// CodeFromHTTP returns the gRPC status code for an unsuccessful HTTP response
+// of one of the services behind the manage service.
+func CodeFromHTTP(statusCode int) codes.Code {
+	switch {
+	case statusCode == http.StatusBadRequest:
+		return codes.InvalidArgument
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return codes.PermissionDenied
+	case statusCode == http.StatusNotFound:
+		return codes.NotFound
+	case statusCode == http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case statusCode >= 500:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"testing"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestExitCode(t *testing.T) {
@@ -22,3 +25,97 @@ func TestExitCode(t *testing.T) {
 		}
 	})
 }
+
+func TestFromGRPC(t *testing.T) {
+	t.Run("backend error", func(t *testing.T) {
+		s, err := status.New(codes.InvalidArgument, "calling handler: some long error chain").WithDetails(&errdetails.ErrorInfo{
+			Reason: fehler.ReasonBackend,
+			Domain: fehler.Domain,
+			Metadata: map[string]string{
+				"message":            "Username already exists.",
+				"action_error_index": "2",
+			},
+		})
+		if err != nil {
+			t.Fatalf("adding details to status: %v", err)
+		}
+
+		got := fehler.FromGRPC(s.Err())
+		expected := "backend error: Username already exists. (failing action index 2)"
+		if got.Error() != expected {
+			t.Fatalf("wrong error message, expected %q, got %q", expected, got.Error())
+		}
+		if gotS, _ := status.FromError(got); gotS.Code() != codes.InvalidArgument {
+			t.Fatalf("status code was not kept, got %s", gotS.Code())
+		}
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		got := fehler.FromGRPC(status.Error(codes.Unavailable, "connection refused"))
+		if got.Error() != "connection refused" {
+			t.Fatalf("wrong error message, got %q", got.Error())
+		}
+	})
+}
+
+func TestExitCodeFromGRPC(t *testing.T) {
+	for _, tt := range []struct {
+		code     codes.Code
+		expected int
+	}{
+		{codes.Unavailable, fehler.ExitConnection},
+		{codes.Unauthenticated, fehler.ExitAuthentication},
+		{codes.PermissionDenied, fehler.ExitAuthentication},
+		{codes.InvalidArgument, fehler.ExitValidation},
+		{codes.NotFound, fehler.ExitNotFound},
+		{codes.DeadlineExceeded, fehler.ExitTimeout},
+		{codes.Unknown, fehler.ExitGeneral},
+	} {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			err := fmt.Errorf("calling manage service: %w", fehler.FromGRPC(status.Error(tt.code, "some error")))
+			var errExit interface {
+				ExitCode() int
+			}
+			if !errors.As(err, &errExit) {
+				t.Fatalf("unwrapping error did not return exit code error, got: %v", err)
+			}
+			if got := errExit.ExitCode(); got != tt.expected {
+				t.Fatalf("wrong exit code, expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExitCodeBackendRejected(t *testing.T) {
+	s, err := status.New(codes.InvalidArgument, "some error").WithDetails(&errdetails.ErrorInfo{
+		Reason:   fehler.ReasonBackend,
+		Domain:   fehler.Domain,
+		Metadata: map[string]string{"message": "Username already exists."},
+	})
+	if err != nil {
+		t.Fatalf("adding details to status: %v", err)
+	}
+
+	var errExit interface {
+		ExitCode() int
+	}
+	if !errors.As(fehler.FromGRPC(s.Err()), &errExit) {
+		t.Fatalf("unwrapping error did not return exit code error")
+	}
+	if got := errExit.ExitCode(); got != fehler.ExitBackendRejected {
+		t.Fatalf("wrong exit code, expected %d, got %d", fehler.ExitBackendRejected, got)
+	}
+}
+
+func TestWithCode(t *testing.T) {
+	err := fmt.Errorf("validating: %w", fehler.WithCode(codes.InvalidArgument, errors.New("missing field")))
+	var se interface {
+		GRPCStatus() *status.Status
+	}
+	if !errors.As(err, &se) {
+		t.Fatalf("unwrapping error did not return error with gRPC status, got: %v", err)
+	}
+	if got := se.GRPCStatus().Code(); got != codes.InvalidArgument {
+		t.Fatalf("wrong status code, expected %s, got %s", codes.InvalidArgument, got)
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"strings"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/codes"
 )
 
 const (
@@ -35,6 +37,7 @@ func Cmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 	}
 	cp := connection.Unary(cmd)
+	fl := connection.Multi(cmd, cp)
 
 	existsHelpText := "check only for existance (requires --filter)"
 	exists := cmd.Flags().Bool("exists", false, existsHelpText)
@@ -51,24 +54,30 @@ func Cmd() *cobra.Command {
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		// validate flags
 		if *filter != nil && *filterRaw != "" {
-			return fmt.Errorf("simple and raw filter provided, only either is allowed")
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("simple and raw filter provided, only either is allowed"))
 		}
 		if *exists {
 			if *filter == nil && *filterRaw == "" {
-				return fmt.Errorf("filter missing, needed to check existance of a model")
+				return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("filter missing, needed to check existance of a model"))
 			}
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
+		collection := args[0]
+		if fl.Enabled() {
+			return fl.Run(cmd, func(ctx context.Context, cl proto.ManageClient, _ connection.Params) error {
+				return Run(ctx, cl, collection, *exists, *filter, *filterRaw, *fields)
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := cp.Dial(ctx)
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
 		defer close()
 
-		collection := args[0]
 		if err := Run(ctx, cl, collection, *exists, *filter, *filterRaw, *fields); err != nil {
 			return fmt.Errorf("getting collection %s: %w", collection, err)
 		}
@@ -94,12 +103,12 @@ func Run(ctx context.Context, gc gRPCClient, collection string, exists bool, fil
 
 	resp, err := gc.Get(ctx, in)
 	if err != nil {
-		s, _ := status.FromError(err) // The ok value does not matter here.
-		return fmt.Errorf("calling manage service: %s", s.Message())
+		return fmt.Errorf("calling manage service: %w", fehler.FromGRPC(err))
 	}
 
-	fmt.Printf("%s\n", resp.Value)
-	return nil
+	p := output.FromContext(ctx)
+	p.Printf("%s\n", resp.Value)
+	return p.Result(output.RawJSON([]byte(resp.Value)))
 }
 
 // Server
@@ -113,10 +122,16 @@ type datastorereader interface {
 // Get queries the datastore-reader for requested models
 // This function is the server side entrypoint for this package.
 func Get(ctx context.Context, in *proto.GetRequest, ds datastorereader) (*proto.GetResponse, error) {
+	if in.Collection == "" {
+		return nil, fehler.WithCode(codes.InvalidArgument, fmt.Errorf("missing collection"))
+	}
 	var filter string = in.FilterRaw
 	if filter == "" {
 		filter = makeFilterString(in.Filter)
 	}
+	if in.Exists && filter == "" {
+		return nil, fehler.WithCode(codes.InvalidArgument, fmt.Errorf("filter missing, needed to check existance of a model"))
+	}
 	var fields = makeFieldsString(in.Fields)
 	// if --exists was provided do a /exists request
 	if in.Exists {
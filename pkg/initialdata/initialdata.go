@@ -3,18 +3,21 @@ package initialdata
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"strings"
 
+	"github.com/OpenSlides/openslides-manage-service/pkg/backendaction"
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
 	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setpassword"
 	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/codes"
 )
 
 const (
@@ -51,10 +54,10 @@ func Cmd() *cobra.Command {
 			data = d
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := cp.Dial(ctx)
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -82,14 +85,14 @@ func Run(ctx context.Context, gc gRPCClient, data []byte) error {
 
 	resp, err := gc.InitialData(ctx, req)
 	if err != nil {
-		s, _ := status.FromError(err) // The ok value does not matter here.
-		return fmt.Errorf("calling manage service (setting initial data): %s", s.Message())
+		return fmt.Errorf("calling manage service (setting initial data): %w", fehler.FromGRPC(err))
 	}
 	if !resp.Initialized {
-		return fehler.ExitCode(2, fmt.Errorf("datastore contains data, initial data were NOT set"))
+		return fehler.ExitCode(fehler.ExitInitialDataNotSet, fmt.Errorf("datastore contains data, initial data were NOT set"))
 	}
-	fmt.Println("Initial data were set successfully.")
-	return nil
+	p := output.FromContext(ctx)
+	p.Printf("Initial data were set successfully.\n")
+	return p.Result(map[string]bool{"initialized": true})
 }
 
 // Server
@@ -106,8 +109,8 @@ func InitialData(ctx context.Context, in *proto.InitialDataRequest, superadminSe
 	if initialData == nil {
 		// The backend expects at least an empty object.
 		initialData = []byte("{}")
-	} else {
-		// TODO: validate data
+	} else if !json.Valid(initialData) {
+		return nil, fehler.WithCode(codes.InvalidArgument, fmt.Errorf("initial data are not valid JSON"))
 	}
 
 	name := "organization.initial_import"
@@ -125,7 +128,8 @@ func InitialData(ctx context.Context, in *proto.InitialDataRequest, superadminSe
 
 	if _, err := ba.Single(ctx, name, data); err != nil {
 		// There is no action result in success case.
-		if strings.Contains(err.Error(), datastoreNotEmptyMsg) {
+		var backendErr *backendaction.Error
+		if errors.As(err, &backendErr) && strings.Contains(backendErr.Message, datastoreNotEmptyMsg) {
 			return &proto.InitialDataResponse{Initialized: false}, nil
 		}
 		return nil, fmt.Errorf("requesting backend action %q: %w", name, err)
@@ -140,9 +144,9 @@ func InitialData(ctx context.Context, in *proto.InitialDataRequest, superadminSe
 
 // SetSuperadminPassword sets the first password for the superadmin according to respective secret.
 func SetSuperadminPassword(ctx context.Context, superadminSecretFile string, ba backendAction) error {
-	sapw, err := os.ReadFile(superadminSecretFile)
+	sapw, err := secrets.Read(superadminSecretFile)
 	if err != nil {
-		return fmt.Errorf("reading file %q: %w", superadminSecretFile, err)
+		return fmt.Errorf("reading superadmin secret: %w", err)
 	}
 	if err := setpassword.Execute(ctx, 1, string(sapw), ba); err != nil {
 		return fmt.Errorf("setting superadmin password: %w", err)
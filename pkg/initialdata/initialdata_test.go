@@ -9,6 +9,7 @@ import (
 	"path"
 	"testing"
 
+	"github.com/OpenSlides/openslides-manage-service/pkg/backendaction"
 	"github.com/OpenSlides/openslides-manage-service/pkg/initialdata"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
 	"github.com/OpenSlides/openslides-manage-service/proto"
@@ -66,7 +67,8 @@ func TestInitialdata(t *testing.T) {
 // Server tests
 
 type mockAction struct {
-	called map[string][]json.RawMessage
+	called   map[string][]json.RawMessage
+	notEmpty bool
 }
 
 func newMockAction() *mockAction {
@@ -79,6 +81,12 @@ func (m *mockAction) Single(ctx context.Context, name string, data json.RawMessa
 	switch name {
 	case "organization.initial_import", "user.set_password":
 		m.called[name] = append(m.called[name], data)
+		if name == "organization.initial_import" && m.notEmpty {
+			return nil, fmt.Errorf("sending request: %w", &backendaction.Error{
+				StatusCode: 400,
+				Message:    "Datastore is not empty.",
+			})
+		}
 	default:
 		return nil, fmt.Errorf("action %q is not defined here", name)
 	}
@@ -130,4 +138,20 @@ func TestInitialDataServerAll(t *testing.T) {
 			t.Fatalf("wrong superadmin password, expected %q, got %q", expected, got)
 		}
 	})
+
+	t.Run("running with datastore that is not empty", func(t *testing.T) {
+		ma := newMockAction()
+		ma.notEmpty = true
+		p := path.Join(testDir, setup.SecretsDirName, setup.SuperadminFileName)
+		resp, err := initialdata.InitialData(ctx, in, p, ma)
+		if err != nil {
+			t.Fatalf("running InitialData() failed: %v", err)
+		}
+		if resp.Initialized {
+			t.Fatalf("running InitialData() should return a falsy result, got truthy")
+		}
+		if len(ma.called["user.set_password"]) != 0 {
+			t.Fatalf("superadmin password should not be set")
+		}
+	})
 }
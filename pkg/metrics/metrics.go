@@ -0,0 +1,264 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets for latencies in
+// seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metric is implemented by all metric types.
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+// registry contains all metrics of the process.
+var registry = struct {
+	mu      sync.Mutex
+	metrics []metric
+}{}
+
+func register(m metric) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, e := range registry.metrics {
+		if e.name() == m.name() {
+			panic(fmt.Sprintf("metric %q registered twice", m.name()))
+		}
+	}
+	registry.metrics = append(registry.metrics, m)
+}
+
+// vec contains the values of a metric for all combinations of label values.
+type vec struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]interface{} // The key is the joined label values.
+	values map[string][]string
+}
+
+func newVec(name, help, typ string, labels []string) vec {
+	return vec{
+		metricName: name,
+		help:       help,
+		typ:        typ,
+		labels:     labels,
+		series:     make(map[string]interface{}),
+		values:     make(map[string][]string),
+	}
+}
+
+func (v *vec) name() string {
+	return v.metricName
+}
+
+// get returns the series for the label values. It creates a new one with
+// the given function if it does not exist. The caller has to hold the lock.
+func (v *vec) get(labelValues []string, create func() interface{}) interface{} {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %q: expected %d label values, got %d", v.metricName, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = create()
+		v.series[key] = s
+		v.values[key] = append([]string{}, labelValues...)
+	}
+	return s
+}
+
+// sortedKeys returns the keys of all series in a stable order. The caller
+// has to hold the lock.
+func (v *vec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.metricName, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.metricName, v.typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelText returns the labels in text format, e. g. {method="Get",code="OK"}.
+// Extra labels are appended.
+func (v *vec) labelText(key string, extra ...string) string {
+	var pairs []string
+	for i, value := range v.values[key] {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, v.labels[i], labelEscaper.Replace(value)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], labelEscaper.Replace(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a metric that only increases.
+type Counter struct {
+	vec
+}
+
+// NewCounter creates and registers a new counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, "counter", labels)}
+	register(c)
+	return c
+}
+
+// Inc increases the counter for the given label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter for the given label values.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.get(labelValues, func() interface{} { return new(float64) }).(*float64)
+	*p += delta
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w)
+	for _, k := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labelText(k), formatFloat(*c.series[k].(*float64)))
+	}
+}
+
+// Gauge is a metric that can be set to any value.
+type Gauge struct {
+	vec
+}
+
+// NewGauge creates and registers a new gauge with the given label names.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, "gauge", labels)}
+	register(g)
+	return g
+}
+
+// Set sets the gauge for the given label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.get(labelValues, func() interface{} { return new(float64) }).(*float64)
+	*p = value
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(w)
+	for _, k := range g.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, g.labelText(k), formatFloat(*g.series[k].(*float64)))
+	}
+}
+
+// Histogram is a metric that counts observations in buckets.
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+type histogramSeries struct {
+	counts []uint64 // One count per bucket, not cumulative.
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates and registers a new histogram with the given upper
+// bounds of the buckets and label names.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	register(h)
+	return h
+}
+
+// Observe adds an observation for the given label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues, func() interface{} {
+		return &histogramSeries{counts: make([]uint64, len(h.buckets))}
+	}).(*histogramSeries)
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, k := range h.sortedKeys() {
+		s := h.series[k].(*histogramSeries)
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelText(k, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelText(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelText(k), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelText(k), s.count)
+	}
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Write writes all registered metrics in the Prometheus text format.
+func Write(w io.Writer) error {
+	registry.mu.Lock()
+	metrics := append([]metric{}, registry.metrics...)
+	registry.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler returns a HTTP handler that serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
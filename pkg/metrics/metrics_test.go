@@ -0,0 +1,59 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	c := metrics.NewCounter("test_counter_total", "A test counter.", "method", "code")
+	c.Inc("Get", "OK")
+	c.Add(2, "Get", "OK")
+	c.Inc("Set", `quo"te`)
+
+	g := metrics.NewGauge("test_gauge", "A test gauge.")
+	g.Set(1.5)
+
+	h := metrics.NewHistogram("test_histogram_seconds", "A test histogram.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "get")
+	h.Observe(0.5, "get")
+	h.Observe(5, "get")
+
+	buf := new(bytes.Buffer)
+	if err := metrics.Write(buf); err != nil {
+		t.Fatalf("writing metrics: %v", err)
+	}
+	got := buf.String()
+
+	for _, expected := range []string{
+		"# HELP test_counter_total A test counter.\n# TYPE test_counter_total counter\n",
+		`test_counter_total{method="Get",code="OK"} 3` + "\n",
+		`test_counter_total{method="Set",code="quo\"te"} 1` + "\n",
+		"# TYPE test_gauge gauge\ntest_gauge 1.5\n",
+		"# TYPE test_histogram_seconds histogram\n",
+		`test_histogram_seconds_bucket{route="get",le="0.1"} 1` + "\n",
+		`test_histogram_seconds_bucket{route="get",le="1"} 2` + "\n",
+		`test_histogram_seconds_bucket{route="get",le="+Inf"} 3` + "\n",
+		`test_histogram_seconds_sum{route="get"} 5.55` + "\n",
+		`test_histogram_seconds_count{route="get"} 3` + "\n",
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("output does not contain %q, got:\n%s", expected, got)
+		}
+	}
+
+	t.Run("handler", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Fatalf("wrong content type %q", ct)
+		}
+		if !strings.Contains(rec.Body.String(), "test_gauge 1.5") {
+			t.Fatalf("response does not contain gauge, got:\n%s", rec.Body.String())
+		}
+	})
+}
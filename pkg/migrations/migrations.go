@@ -8,11 +8,13 @@ import (
 	"time"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/codes"
 )
 
 const (
@@ -25,6 +27,7 @@ const (
 
 	defaultInterval  = 1 * time.Second
 	withIntervalFlag = true
+	withFleetFlags   = true
 	migrationRunning = "migration_running"
 
 	maxCallRecvMsgSize = 1073741824 // corresponds to 1 GB
@@ -58,7 +61,7 @@ func migrateCmd() *cobra.Command {
 		Short: "Prepare migrations but do not apply them to the datastore.",
 		Args:  cobra.NoArgs,
 	}
-	return setupMigrationCmd(cmd, withIntervalFlag)
+	return setupMigrationCmd(cmd, withIntervalFlag, !withFleetFlags)
 }
 
 func finalizeCmd() *cobra.Command {
@@ -67,7 +70,7 @@ func finalizeCmd() *cobra.Command {
 		Short: "Prepare migrations and apply them to the datastore.",
 		Args:  cobra.NoArgs,
 	}
-	return setupMigrationCmd(cmd, withIntervalFlag)
+	return setupMigrationCmd(cmd, withIntervalFlag, !withFleetFlags)
 }
 
 func resetCmd() *cobra.Command {
@@ -76,7 +79,7 @@ func resetCmd() *cobra.Command {
 		Short: "Reset unapplied migrations.",
 		Args:  cobra.NoArgs,
 	}
-	return setupMigrationCmd(cmd, !withIntervalFlag)
+	return setupMigrationCmd(cmd, !withIntervalFlag, !withFleetFlags)
 }
 
 func clearCollectionfieldTablesCmd() *cobra.Command {
@@ -85,7 +88,7 @@ func clearCollectionfieldTablesCmd() *cobra.Command {
 		Short: "Clear all data from auxillary tables. Can be done to clean up diskspace, but only when OpenSlides is offline.",
 		Args:  cobra.NoArgs,
 	}
-	return setupMigrationCmd(cmd, !withIntervalFlag)
+	return setupMigrationCmd(cmd, !withIntervalFlag, !withFleetFlags)
 }
 
 func statsCmd() *cobra.Command {
@@ -94,7 +97,7 @@ func statsCmd() *cobra.Command {
 		Short: "Print some statistics about the current migration state.",
 		Args:  cobra.NoArgs,
 	}
-	return setupMigrationCmd(cmd, !withIntervalFlag)
+	return setupMigrationCmd(cmd, !withIntervalFlag, withFleetFlags)
 }
 
 func progressCmd() *cobra.Command {
@@ -103,10 +106,10 @@ func progressCmd() *cobra.Command {
 		Short: "Query the progress of a currently running migration command.",
 		Args:  cobra.NoArgs,
 	}
-	return setupMigrationCmd(cmd, !withIntervalFlag)
+	return setupMigrationCmd(cmd, !withIntervalFlag, withFleetFlags)
 }
 
-func setupMigrationCmd(cmd *cobra.Command, withInterval bool) *cobra.Command {
+func setupMigrationCmd(cmd *cobra.Command, withInterval bool, withFleet bool) *cobra.Command {
 	cp := connection.Unary(cmd)
 
 	var interval *time.Duration
@@ -116,13 +119,24 @@ func setupMigrationCmd(cmd *cobra.Command, withInterval bool) *cobra.Command {
 		interval = cmd.Flags().Duration("interval", defaultInterval, intervalHelpText)
 	}
 
+	var fl connection.Fleet
+	if withFleet {
+		fl = connection.Multi(cmd, cp)
+	}
+
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
+		if withFleet && fl.Enabled() {
+			return fl.Run(cmd, func(ctx context.Context, cl proto.ManageClient, p connection.Params) error {
+				return Run(ctx, cl, cmd.Use, interval, p.Timeout)
+			})
+		}
+
+		ctx := cmd.Context()
 
 		dialCtx, cancel := context.WithTimeout(ctx, *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(dialCtx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := cp.Dial(dialCtx)
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -150,6 +164,8 @@ func Run(ctx context.Context, gc gRPCClient, command string, intervalFlag *time.
 		return fmt.Errorf("running migrations command: %w", err)
 	}
 
+	p := output.FromContext(ctx)
+
 	var interval time.Duration
 	if intervalFlag != nil {
 		interval = *intervalFlag
@@ -166,15 +182,15 @@ func Run(ctx context.Context, gc gRPCClient, command string, intervalFlag *time.
 		if err != nil {
 			return fmt.Errorf("parsing migrations response: %w", err)
 		}
-		fmt.Print(mRText)
-		return nil
+		p.Printf("%s", mRText)
+		return p.Result(mR)
 	}
 
 	outCount := 0
-	fmt.Print("Progress:\n")
+	p.Printf("Progress:\n")
 	for {
 		time.Sleep(interval)
-		mR, err := runMigrationsCmd(ctx, gc, "progress", *timeoutFlag)
+		mR, err = runMigrationsCmd(ctx, gc, "progress", *timeoutFlag)
 		if err != nil {
 			return fmt.Errorf("running migrations command: %w", err)
 		}
@@ -184,10 +200,10 @@ func Run(ctx context.Context, gc gRPCClient, command string, intervalFlag *time.
 			if err != nil {
 				return fmt.Errorf("parsing migrations response: %w", err)
 			}
-			fmt.Print(out)
+			p.Printf("%s", out)
 		} else {
 			out, c := mR.OutputSince(outCount)
-			fmt.Print(out)
+			p.Printf("%s", out)
 			outCount = c
 		}
 
@@ -196,7 +212,7 @@ func Run(ctx context.Context, gc gRPCClient, command string, intervalFlag *time.
 		}
 	}
 
-	return nil
+	return p.Result(mR)
 }
 
 // MigrationResponse handles the JSON response from the backend when calling
@@ -281,8 +297,7 @@ func runMigrationsCmd(ctx context.Context, gc gRPCClient, command string, timeou
 		grpc.MaxCallRecvMsgSize(maxCallRecvMsgSize),
 	)
 	if err != nil {
-		s, _ := status.FromError(err) // The ok value does not matter here.
-		return MigrationResponse{}, fmt.Errorf("calling manage service (running migrations command): %s", s.Message())
+		return MigrationResponse{}, fmt.Errorf("calling manage service (running migrations command): %w", fehler.FromGRPC(err))
 	}
 
 	var mR MigrationResponse
@@ -300,6 +315,9 @@ type backendAction interface {
 
 // Migrations runs a migrations command.
 func Migrations(ctx context.Context, in *proto.MigrationsRequest, ba backendAction) (*proto.MigrationsResponse, error) {
+	if in.Command == "" {
+		return nil, fehler.WithCode(codes.InvalidArgument, fmt.Errorf("missing migrations command"))
+	}
 	result, err := ba.Migrations(ctx, in.Command)
 	if err != nil {
 		return nil, fmt.Errorf("requesting backend migrations command %q: %w", in.Command, err)
@@ -0,0 +1,175 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// FormatText is the default output format. Commands print human readable
+	// messages.
+	FormatText = "text"
+
+	// FormatJSON is the machine-readable output format. Every command prints
+	// exactly one JSON document.
+	FormatJSON = "json"
+)
+
+// Printer prints the results of a command in the requested format.
+type Printer struct {
+	w      io.Writer
+	format string
+}
+
+// New returns a new printer that writes to the given writer.
+func New(w io.Writer, format string) (*Printer, error) {
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("unknown output format %q, use %q or %q", format, FormatText, FormatJSON)
+	}
+	return &Printer{w: w, format: format}, nil
+}
+
+// JSON returns true if the printer uses the JSON output format.
+func (p *Printer) JSON() bool {
+	return p.format == FormatJSON
+}
+
+// Printf prints a human readable message. It does nothing in JSON output
+// format.
+func (p *Printer) Printf(format string, a ...interface{}) {
+	if p.JSON() {
+		return
+	}
+	fmt.Fprintf(p.w, format, a...)
+}
+
+// document is the JSON document printed by a command.
+type document struct {
+	OK     bool        `json:"ok"`
+	Result interface{} `json:"result,omitempty"`
+	Error  *errorDoc   `json:"error,omitempty"`
+}
+
+type errorDoc struct {
+	Message  string            `json:"message"`
+	ExitCode int               `json:"exit_code"`
+	GRPCCode string            `json:"grpc_code,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+}
+
+// Result prints the result of a successful command. It does nothing in text
+// output format.
+func (p *Printer) Result(v interface{}) error {
+	if !p.JSON() {
+		return nil
+	}
+	return p.print(document{OK: true, Result: v})
+}
+
+// Error prints an error of a failed command together with its exit code. It
+// does nothing in text output format.
+func (p *Printer) Error(err error, exitCode int) error {
+	if !p.JSON() {
+		return nil
+	}
+	return p.print(document{Error: newErrorDoc(err, exitCode)})
+}
+
+// Partial prints the result of a command that failed partially together with
+// the error. It does nothing in text output format. The caller should return
+// the error wrapped with Reported, so it is not printed again.
+func (p *Printer) Partial(v interface{}, err error, exitCode int) error {
+	if !p.JSON() {
+		return nil
+	}
+	return p.print(document{Result: v, Error: newErrorDoc(err, exitCode)})
+}
+
+func newErrorDoc(err error, exitCode int) *errorDoc {
+	doc := &errorDoc{
+		Message:  err.Error(),
+		ExitCode: exitCode,
+	}
+
+	var errStatus interface {
+		GRPCStatus() *status.Status
+	}
+	if errors.As(err, &errStatus) {
+		s := errStatus.GRPCStatus()
+		doc.GRPCCode = s.Code().String()
+		for _, d := range s.Details() {
+			if info, ok := d.(*errdetails.ErrorInfo); ok {
+				doc.Details = info.Metadata
+			}
+		}
+	}
+	return doc
+}
+
+// reportedError is an error that was already printed in JSON output format.
+type reportedError struct {
+	err error
+}
+
+func (err reportedError) Error() string {
+	return err.err.Error()
+}
+
+func (err reportedError) Unwrap() error {
+	return err.err
+}
+
+// Reported marks the error as already printed, e. g. with Partial.
+func Reported(err error) error {
+	return reportedError{err: err}
+}
+
+// IsReported returns true if the error was marked with Reported.
+func IsReported(err error) bool {
+	var r reportedError
+	return errors.As(err, &r)
+}
+
+func (p *Printer) print(doc document) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("encoding JSON output: %w", err)
+	}
+	return nil
+}
+
+// RawJSON returns the given data as JSON value if it is valid JSON and as
+// string otherwise. Use this for payloads of responses that should be
+// embedded into the result document.
+func RawJSON(data []byte) interface{} {
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	return string(data)
+}
+
+type contextKey int
+
+const printerKey contextKey = iota
+
+// NewContext returns a new context that carries the given printer.
+func NewContext(ctx context.Context, p *Printer) context.Context {
+	return context.WithValue(ctx, printerKey, p)
+}
+
+// FromContext returns the printer of the given context. If the context does
+// not carry a printer, a printer for text output to stdout is returned.
+func FromContext(ctx context.Context) *Printer {
+	if p, ok := ctx.Value(printerKey).(*Printer); ok {
+		return p
+	}
+	return &Printer{w: os.Stdout, format: FormatText}
+}
@@ -0,0 +1,148 @@
+package output_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPrinter(t *testing.T) {
+	t.Run("text format", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		p, err := output.New(buf, output.FormatText)
+		if err != nil {
+			t.Fatalf("creating printer: %v", err)
+		}
+		p.Printf("User %d created successfully.\n", 5)
+		if err := p.Result(map[string]int{"user_id": 5}); err != nil {
+			t.Fatalf("printing result: %v", err)
+		}
+		expected := "User 5 created successfully.\n"
+		if got := buf.String(); got != expected {
+			t.Fatalf("wrong output, expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("JSON format", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		p, err := output.New(buf, output.FormatJSON)
+		if err != nil {
+			t.Fatalf("creating printer: %v", err)
+		}
+		p.Printf("User %d created successfully.\n", 5)
+		if err := p.Result(map[string]interface{}{"user_id": 5, "payload": output.RawJSON([]byte(`[{"id":1}]`))}); err != nil {
+			t.Fatalf("printing result: %v", err)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("output is not a JSON document: %v\n%s", err, buf.String())
+		}
+		if got["ok"] != true {
+			t.Fatalf("wrong ok value, got %v", got["ok"])
+		}
+		result := got["result"].(map[string]interface{})
+		if result["user_id"] != 5.0 {
+			t.Fatalf("wrong user_id, got %v", result["user_id"])
+		}
+		if _, ok := result["payload"].([]interface{}); !ok {
+			t.Fatalf("raw JSON payload was not embedded, got %v", result["payload"])
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if _, err := output.New(new(bytes.Buffer), "xml"); err == nil {
+			t.Fatalf("creating printer with unknown format should fail but it didn't")
+		}
+	})
+
+	t.Run("printer from context", func(t *testing.T) {
+		p, _ := output.New(new(bytes.Buffer), output.FormatJSON)
+		if output.FromContext(output.NewContext(context.Background(), p)) != p {
+			t.Fatalf("got wrong printer from context")
+		}
+		if output.FromContext(context.Background()).JSON() {
+			t.Fatalf("default printer should use text format")
+		}
+	})
+}
+
+func TestPrinterError(t *testing.T) {
+	s, err := status.New(codes.InvalidArgument, "some error").WithDetails(&errdetails.ErrorInfo{
+		Reason:   fehler.ReasonBackend,
+		Domain:   fehler.Domain,
+		Metadata: map[string]string{"message": "Username already exists.", "action_error_index": "0"},
+	})
+	if err != nil {
+		t.Fatalf("adding details to status: %v", err)
+	}
+	err = fmt.Errorf("creating user: %w", fehler.FromGRPC(s.Err()))
+
+	buf := new(bytes.Buffer)
+	p, _ := output.New(buf, output.FormatJSON)
+	if err := p.Error(err, fehler.ExitBackendRejected); err != nil {
+		t.Fatalf("printing error: %v", err)
+	}
+
+	var got struct {
+		OK    bool `json:"ok"`
+		Error struct {
+			Message  string            `json:"message"`
+			ExitCode int               `json:"exit_code"`
+			GRPCCode string            `json:"grpc_code"`
+			Details  map[string]string `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not a JSON document: %v\n%s", err, buf.String())
+	}
+	if got.OK {
+		t.Fatalf("ok should be false for errors")
+	}
+	if got.Error.ExitCode != fehler.ExitBackendRejected || got.Error.GRPCCode != "InvalidArgument" {
+		t.Fatalf("wrong exit code or gRPC code, got %d and %s", got.Error.ExitCode, got.Error.GRPCCode)
+	}
+	if got.Error.Details["action_error_index"] != "0" {
+		t.Fatalf("wrong details, got %v", got.Error.Details)
+	}
+	if got.Error.Message != err.Error() {
+		t.Fatalf("wrong message, expected %q, got %q", err.Error(), got.Error.Message)
+	}
+}
+
+func TestPrinterPartial(t *testing.T) {
+	err := output.Reported(fehler.ExitCode(fehler.ExitPartialSuccess, fmt.Errorf("1 of 2 instances failed")))
+
+	buf := new(bytes.Buffer)
+	p, _ := output.New(buf, output.FormatJSON)
+	if err := p.Partial(map[string]int{"succeeded": 1}, err, fehler.ExitPartialSuccess); err != nil {
+		t.Fatalf("printing partial result: %v", err)
+	}
+
+	var got struct {
+		OK     bool           `json:"ok"`
+		Result map[string]int `json:"result"`
+		Error  struct {
+			ExitCode int `json:"exit_code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not a JSON document: %v\n%s", err, buf.String())
+	}
+	if got.OK || got.Result["succeeded"] != 1 || got.Error.ExitCode != fehler.ExitPartialSuccess {
+		t.Fatalf("wrong document: %s", buf.String())
+	}
+
+	if !output.IsReported(err) || output.IsReported(errors.Unwrap(err)) {
+		t.Fatalf("IsReported does not detect reported errors")
+	}
+}
@@ -0,0 +1,332 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// SecretsHelp contains the short help text for the command.
+	SecretsHelp = "Manages encrypted secrets"
+
+	// SecretsHelpExtra contains the long help text for the command without
+	// the headline.
+	SecretsHelpExtra = `Secrets are encrypted with a key derived from a passphrase. The passphrase is
+read from the file given in OPENSLIDES_KEYSTORE_PASSPHRASE_FILE or from
+OPENSLIDES_KEYSTORE_PASSPHRASE.
+
+Keystores are files with many named secrets. Use a secret of a keystore with
+the URI keystore:///path/to/keystore#name.
+
+A secrets directory created with setup --encrypt contains one encrypted file
+name.enc per secret and can be committed safely. Decrypt it before starting
+OpenSlides.`
+
+	// defaultSecretsDir is the secrets directory created by the setup
+	// command.
+	defaultSecretsDir = "secrets"
+
+	// defaultEditor is used if EDITOR is not set.
+	defaultEditor = "vi"
+)
+
+// shmDir is the shared memory tmpfs used for decrypted secrets if
+// XDG_RUNTIME_DIR is not set. It is a variable for tests.
+var shmDir = "/dev/shm"
+
+// Cmd returns the subcommand.
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: SecretsHelp,
+		Long:  SecretsHelp + "\n\n" + SecretsHelpExtra,
+	}
+	cmd.AddCommand(
+		cmdSet(),
+		cmdList(),
+		cmdDecrypt(),
+		cmdEncrypt(),
+		cmdEdit(),
+	)
+	return cmd
+}
+
+func cmdSet() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set keystore name [value]",
+		Short: "Stores a secret in a keystore, the keystore is created if it does not exist",
+		Args:  cobra.RangeArgs(2, 3),
+	}
+	valueFile := cmd.Flags().StringP("file", "f", "", "file with the value; you can use - to provide the value via stdin")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		args = append(args, "") // This is to ensure that the slice always has enough values.
+		filename, name := args[0], args[1]
+		value, err := shared.InputOrFileOrStdin(args[2], *valueFile)
+		if err != nil {
+			return fmt.Errorf("reading value from positional argument or file or stdin: %w", err)
+		}
+
+		k, err := readOrCreateKeystore(filename)
+		if err != nil {
+			return err
+		}
+		if err := k.Set(name, value); err != nil {
+			return fehler.ExitCode(fehler.ExitValidation, err)
+		}
+		if err := k.Write(filename); err != nil {
+			return err
+		}
+
+		p := output.FromContext(cmd.Context())
+		p.Printf("Secret %q stored in keystore %s.\n", name, filename)
+		return p.Result(map[string]string{"keystore": filename, "name": name})
+	}
+	return cmd
+}
+
+func cmdList() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list keystore",
+		Short: "Prints the names of all secrets in a keystore",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		passphrase, err := KeystorePassphrase()
+		if err != nil {
+			return fehler.ExitCode(fehler.ExitValidation, err)
+		}
+		k, err := ReadKeystore(args[0], passphrase)
+		if err != nil {
+			return err
+		}
+
+		p := output.FromContext(cmd.Context())
+		names := k.Names()
+		for _, name := range names {
+			p.Printf("%s\n", name)
+		}
+		return p.Result(map[string][]string{"names": names})
+	}
+	return cmd
+}
+
+func cmdDecrypt() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "decrypt [directory]",
+		Short: "Decrypts all secrets of an encrypted secrets directory",
+		Long: `Decrypts all secrets of an encrypted secrets directory (default ./secrets).
+The plaintext files are written into the directory given with --to, e. g. a
+tmpfs like /run/openslides/secrets. Without --to they are written next to the
+encrypted files, where they are ignored by git.`,
+		Args: cobra.MaximumNArgs(1),
+	}
+	to := cmd.Flags().String("to", "", "directory for the plaintext files, defaults to the secrets directory")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		dir := defaultSecretsDir
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		dst := dir
+		if *to != "" {
+			dst = *to
+		}
+
+		c, err := cipherFromEnv()
+		if err != nil {
+			return err
+		}
+		names, err := DecryptDir(dir, dst, c)
+		if err != nil {
+			return fmt.Errorf("decrypting secrets: %w", err)
+		}
+
+		p := output.FromContext(cmd.Context())
+		p.Printf("%d secrets decrypted to %s.\n", len(names), dst)
+		return p.Result(map[string]interface{}{"directory": dst, "names": names})
+	}
+	return cmd
+}
+
+func cmdEncrypt() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "encrypt [directory]",
+		Short: "Encrypts all plaintext secrets of a secrets directory",
+		Long: `Encrypts all plaintext secrets of a secrets directory (default ./secrets) into
+files with the suffix .enc and creates a .gitignore file that ignores the
+plaintext files. Use this to encrypt the secrets of an existing setup.`,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		dir := defaultSecretsDir
+		if len(args) > 0 {
+			dir = args[0]
+		}
+
+		c, err := cipherFromEnv()
+		if err != nil {
+			return err
+		}
+		names, err := EncryptDir(dir, c)
+		if err != nil {
+			return fmt.Errorf("encrypting secrets: %w", err)
+		}
+
+		p := output.FromContext(cmd.Context())
+		p.Printf("%d secrets encrypted in %s.\n", len(names), dir)
+		return p.Result(map[string]interface{}{"directory": dir, "names": names})
+	}
+	return cmd
+}
+
+func cmdEdit() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edit name",
+		Short: "Edits an encrypted secret with the editor from EDITOR",
+		Long: `Decrypts the secret name.enc of the secrets directory into a temporary file,
+opens it with the editor from EDITOR (default vi) and encrypts it again. A new
+secret is created if it does not exist. A newline added by the editor at the
+end is removed unless the old value ended with a newline.
+
+The temporary file is created in XDG_RUNTIME_DIR or /dev/shm, so the plaintext
+is only written to memory. If neither exists, the command fails unless
+--allow-disk is given.`,
+		Args: cobra.ExactArgs(1),
+	}
+	dir := cmd.Flags().StringP("dir", "d", defaultSecretsDir, "encrypted secrets directory")
+	allowDisk := cmd.Flags().Bool("allow-disk", false, "write the temporary file to the temporary directory of the system if no tmpfs is found")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if name == "" || strings.ContainsAny(name, "/") || strings.HasPrefix(name, ".") {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("invalid secret name %q", name))
+		}
+
+		c, err := cipherFromEnv()
+		if err != nil {
+			return err
+		}
+		changed, err := Edit(*dir, name, editor(), c, *allowDisk)
+		if err != nil {
+			return fmt.Errorf("editing secret %q: %w", name, err)
+		}
+
+		p := output.FromContext(cmd.Context())
+		if changed {
+			p.Printf("Secret %q saved.\n", name)
+		} else {
+			p.Printf("Secret %q not changed.\n", name)
+		}
+		return p.Result(map[string]interface{}{"name": name, "changed": changed})
+	}
+	return cmd
+}
+
+// Edit opens the decrypted secret in the editor and encrypts the result. It
+// reports whether the secret was changed. The plaintext is only written to a
+// tmpfs unless allowDisk is true.
+func Edit(dir, name string, editor []string, c *Cipher, allowDisk bool) (bool, error) {
+	old, err := c.DecryptFile(path.Join(dir, name+EncryptedSuffix))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	parent, err := plaintextDir(allowDisk)
+	if err != nil {
+		return false, err
+	}
+	tmpDir, err := os.MkdirTemp(parent, "openslides-secret-")
+	if err != nil {
+		return false, fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	tmpFile := path.Join(tmpDir, name)
+	if err := os.WriteFile(tmpFile, old, 0600); err != nil {
+		return false, fmt.Errorf("writing temporary file: %w", err)
+	}
+
+	e := exec.Command(editor[0], append(editor[1:], tmpFile)...)
+	e.Stdin = os.Stdin
+	e.Stdout = os.Stdout
+	e.Stderr = os.Stderr
+	if err := e.Run(); err != nil {
+		return false, fmt.Errorf("running editor %q: %w", editor[0], err)
+	}
+
+	value, err := os.ReadFile(tmpFile)
+	if err != nil {
+		return false, fmt.Errorf("reading temporary file: %w", err)
+	}
+	if !bytes.HasSuffix(old, []byte("\n")) {
+		value = bytes.TrimSuffix(bytes.TrimSuffix(value, []byte("\n")), []byte("\r"))
+	}
+	if bytes.Equal(old, value) {
+		return false, nil
+	}
+	return WriteEncrypted(dir, name, value, c)
+}
+
+// plaintextDir returns the directory for temporary plaintext files. It is
+// XDG_RUNTIME_DIR or the shared memory tmpfs. The temporary directory of the
+// system, which is usually on disk, is only used if allowDisk is true.
+func plaintextDir(allowDisk bool) (string, error) {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), shmDir} {
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	if allowDisk {
+		return os.TempDir(), nil
+	}
+	return "", fehler.ExitCode(
+		fehler.ExitValidation,
+		fmt.Errorf("no tmpfs found for the plaintext, set XDG_RUNTIME_DIR or use --allow-disk"),
+	)
+}
+
+// editor returns the command of the editor from EDITOR.
+func editor() []string {
+	if e := strings.Fields(os.Getenv("EDITOR")); len(e) > 0 {
+		return e
+	}
+	return []string{defaultEditor}
+}
+
+// cipherFromEnv returns a cipher with the passphrase from the environment.
+func cipherFromEnv() (*Cipher, error) {
+	passphrase, err := KeystorePassphrase()
+	if err != nil {
+		return nil, fehler.ExitCode(fehler.ExitValidation, err)
+	}
+	return NewCipher(passphrase), nil
+}
+
+// readOrCreateKeystore reads the keystore or returns a new one if the file
+// does not exist.
+func readOrCreateKeystore(filename string) (*Keystore, error) {
+	passphrase, err := KeystorePassphrase()
+	if err != nil {
+		return nil, fehler.ExitCode(fehler.ExitValidation, err)
+	}
+	k, err := ReadKeystore(filename, passphrase)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewKeystore(passphrase)
+	}
+	return k, err
+}
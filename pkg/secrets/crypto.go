@@ -0,0 +1,107 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// kdfName is the name of the key derivation function stored with
+	// encrypted data.
+	kdfName = "pbkdf2-sha256"
+
+	keyLength  = 32 // AES-256
+	saltLength = 16
+
+	// kdfMaxIterations is the maximum number of iterations accepted from a
+	// file, so a crafted file can not make the key derivation run for ages.
+	kdfMaxIterations = 5000000
+)
+
+// kdfIterations is the number of PBKDF2 iterations for new keys and
+// kdfMinIterations the minimum accepted from a file. They are variables so
+// tests can use cheaper values.
+var (
+	kdfIterations    = 600000
+	kdfMinIterations = 100000
+)
+
+// errDecrypt is returned if data can not be decrypted.
+var errDecrypt = errors.New("wrong passphrase or corrupted data")
+
+// deriveKey derives an AES key from the passphrase with PBKDF2-HMAC-SHA256.
+func deriveKey(passphrase, salt []byte, iterations int) []byte {
+	return pbkdf2.Key(passphrase, salt, iterations, keyLength, sha256.New)
+}
+
+// checkKDF returns an error if the key derivation parameters of a file are not
+// supported.
+func checkKDF(kdf string, iterations int, salt []byte) error {
+	if kdf != kdfName {
+		return fmt.Errorf("unsupported key derivation %q", kdf)
+	}
+	if iterations < kdfMinIterations || iterations > kdfMaxIterations {
+		return fmt.Errorf("%d iterations are outside of the supported range %d to %d", iterations, kdfMinIterations, kdfMaxIterations)
+	}
+	if len(salt) == 0 {
+		return fmt.Errorf("missing salt")
+	}
+	return nil
+}
+
+// randomBytes returns n random bytes.
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("reading random bytes: %w", err)
+	}
+	return b, nil
+}
+
+// seal encrypts the plaintext with AES-GCM. The random nonce is prepended to
+// the result.
+func seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts data created by seal.
+func open(key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errDecrypt
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCM: %w", err)
+	}
+	return aead, nil
+}
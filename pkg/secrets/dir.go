@@ -0,0 +1,123 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+)
+
+// gitignore ignores the plaintext files in a directory with encrypted secrets.
+const gitignore = `# Created by openslides. Only encrypted secrets are committed.
+*
+!*.enc
+!.gitignore
+`
+
+// encryptedNames returns the names of all encrypted secrets in the directory
+// without suffix.
+func encryptedNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory %q: %w", dir, err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && isEncrypted(e.Name()) {
+			names = append(names, strings.TrimSuffix(e.Name(), EncryptedSuffix))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DecryptDir decrypts all encrypted secrets of the directory src into the
+// directory dst. The directory dst is created if it does not exist. It can be
+// the same as src. It returns the names of the secrets.
+func DecryptDir(src, dst string, c *Cipher) ([]string, error) {
+	names, err := encryptedNames(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return nil, fmt.Errorf("creating directory %q: %w", dst, err)
+	}
+	for _, name := range names {
+		plaintext, err := c.DecryptFile(path.Join(src, name+EncryptedSuffix))
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path.Join(dst, name), plaintext, 0600); err != nil {
+			return nil, fmt.Errorf("writing secret file: %w", err)
+		}
+	}
+	return names, nil
+}
+
+// EncryptDir encrypts all plaintext secrets of the directory and creates a
+// .gitignore file that ignores the plaintext files. Encrypted files with the
+// same value are not changed. It returns the names of the encrypted secrets.
+func EncryptDir(dir string, c *Cipher) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory %q: %w", dir, err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || isEncrypted(e.Name()) || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		plaintext, err := os.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading secret file: %w", err)
+		}
+		changed, err := WriteEncrypted(dir, e.Name(), plaintext, c)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			names = append(names, e.Name())
+		}
+	}
+	if err := WriteGitignore(dir, false); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// WriteEncrypted encrypts the value and writes it to the file name.enc in the
+// directory. If the file exists with the same value, it is not changed. The
+// return value reports whether the file was written.
+func WriteEncrypted(dir, name string, value []byte, c *Cipher) (bool, error) {
+	filename := path.Join(dir, name+EncryptedSuffix)
+	old, err := c.DecryptFile(filename)
+	if err == nil && bytes.Equal(old, value) {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	content, err := c.Encrypt(value)
+	if err != nil {
+		return false, fmt.Errorf("encrypting secret %q: %w", name, err)
+	}
+	if err := shared.CreateFile(dir, true, name+EncryptedSuffix, content); err != nil {
+		return false, fmt.Errorf("writing encrypted secret %q: %w", name, err)
+	}
+	return true, nil
+}
+
+// WriteGitignore creates a .gitignore file in the directory that ignores all
+// plaintext secrets. An existing file is only replaced if force is true.
+func WriteGitignore(dir string, force bool) error {
+	if err := shared.CreateFile(dir, force, ".gitignore", []byte(gitignore)); err != nil {
+		return fmt.Errorf("creating .gitignore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package secrets_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
+)
+
+func TestEncryptedDir(t *testing.T) {
+	dir := t.TempDir()
+	writeSecret(t, path.Join(dir, "manage_auth_password"), "password")
+	writeSecret(t, path.Join(dir, "superadmin"), "superadmin")
+	c := secrets.NewCipher([]byte("passphrase"))
+
+	names, err := secrets.EncryptDir(dir, c)
+	if err != nil {
+		t.Fatalf("encrypting directory: %v", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 encrypted secrets, got %v", names)
+	}
+	if _, err := os.Stat(path.Join(dir, ".gitignore")); err != nil {
+		t.Fatalf("missing .gitignore: %v", err)
+	}
+
+	t.Run("unchanged secrets are not encrypted again", func(t *testing.T) {
+		names, err := secrets.EncryptDir(dir, c)
+		if err != nil {
+			t.Fatalf("encrypting directory: %v", err)
+		}
+		if len(names) != 0 {
+			t.Fatalf("expected no changed secrets, got %v", names)
+		}
+	})
+
+	t.Run("decrypt", func(t *testing.T) {
+		dst := path.Join(t.TempDir(), "tmpfs")
+		names, err := secrets.DecryptDir(dir, dst, secrets.NewCipher([]byte("passphrase")))
+		if err != nil {
+			t.Fatalf("decrypting directory: %v", err)
+		}
+		if len(names) != 2 {
+			t.Fatalf("expected 2 decrypted secrets, got %v", names)
+		}
+		got, err := os.ReadFile(path.Join(dst, "manage_auth_password"))
+		if err != nil {
+			t.Fatalf("reading decrypted secret: %v", err)
+		}
+		if string(got) != "password" {
+			t.Fatalf("wrong secret, expected %q, got %q", "password", got)
+		}
+	})
+
+	t.Run("decrypt with wrong passphrase", func(t *testing.T) {
+		if _, err := secrets.DecryptDir(dir, t.TempDir(), secrets.NewCipher([]byte("wrong"))); err == nil {
+			t.Fatalf("decrypting with wrong passphrase should fail but it didn't")
+		}
+	})
+
+	t.Run("too many iterations", func(t *testing.T) {
+		content := withIterations(t, path.Join(dir, "superadmin.enc"), 1000000000)
+		if _, err := secrets.NewCipher([]byte("passphrase")).Decrypt(content); err == nil {
+			t.Fatalf("decrypting with too many iterations should fail but it didn't")
+		}
+	})
+
+	t.Run("read encrypted file as source", func(t *testing.T) {
+		t.Setenv(secrets.KeystorePassphraseEnv, "passphrase")
+		got, err := secrets.Read(path.Join(dir, "superadmin.enc"))
+		if err != nil {
+			t.Fatalf("reading secret: %v", err)
+		}
+		if string(got) != "superadmin" {
+			t.Fatalf("wrong secret, expected %q, got %q", "superadmin", got)
+		}
+	})
+}
+
+func TestEdit(t *testing.T) {
+	dir := t.TempDir()
+	c := secrets.NewCipher([]byte("passphrase"))
+	if _, err := secrets.WriteEncrypted(dir, "superadmin", []byte("old"), c); err != nil {
+		t.Fatalf("writing encrypted secret: %v", err)
+	}
+
+	// The editor replaces the content and adds a newline like most editors.
+	editor := path.Join(t.TempDir(), "editor")
+	writeSecret(t, editor, "#!/bin/sh\nprintf 'new\\n' > \"$1\"\n")
+	if err := os.Chmod(editor, 0700); err != nil {
+		t.Fatalf("making editor executable: %v", err)
+	}
+
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	changed, err := secrets.Edit(dir, "superadmin", []string{editor}, c, false)
+	if err != nil {
+		t.Fatalf("editing secret: %v", err)
+	}
+	if !changed {
+		t.Fatalf("secret should be changed")
+	}
+	got, err := c.DecryptFile(path.Join(dir, "superadmin.enc"))
+	if err != nil {
+		t.Fatalf("decrypting secret: %v", err)
+	}
+	if string(got) != "new" {
+		t.Fatalf("wrong secret, expected %q, got %q", "new", got)
+	}
+
+	changed, err = secrets.Edit(dir, "superadmin", []string{"true"}, c, false)
+	if err != nil {
+		t.Fatalf("editing secret: %v", err)
+	}
+	if changed {
+		t.Fatalf("secret should not be changed by an editor that does nothing")
+	}
+
+	t.Run("no tmpfs", func(t *testing.T) {
+		t.Setenv("XDG_RUNTIME_DIR", "")
+		secrets.SetShmDir(path.Join(t.TempDir(), "missing"))
+		defer secrets.SetShmDir("/dev/shm")
+
+		if _, err := secrets.Edit(dir, "superadmin", []string{"true"}, c, false); err == nil {
+			t.Fatalf("editing secret without tmpfs should fail but it didn't")
+		}
+		if _, err := secrets.Edit(dir, "superadmin", []string{"true"}, c, true); err != nil {
+			t.Fatalf("editing secret with --allow-disk: %v", err)
+		}
+	})
+}
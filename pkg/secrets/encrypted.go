@@ -0,0 +1,136 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EncryptedSuffix is the file name suffix of encrypted secret files.
+const EncryptedSuffix = ".enc"
+
+const encryptedVersion = 1
+
+// encryptedFile is the format of an encrypted secret file. It is a JSON
+// document, so the files can be committed and diffed.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Data       []byte `json:"data"`
+}
+
+// Cipher encrypts and decrypts secret files with a key derived from a
+// passphrase. All files encrypted with the same cipher share the salt, so the
+// expensive key derivation runs only once per salt.
+type Cipher struct {
+	passphrase []byte
+	salt       []byte
+	keys       map[string][]byte // Keys by salt
+}
+
+// NewCipher returns a cipher for the passphrase.
+func NewCipher(passphrase []byte) *Cipher {
+	return &Cipher{
+		passphrase: passphrase,
+		keys:       make(map[string][]byte),
+	}
+}
+
+func (c *Cipher) key(salt []byte, iterations int) []byte {
+	id := fmt.Sprintf("%x/%d", salt, iterations)
+	k, ok := c.keys[id]
+	if !ok {
+		k = deriveKey(c.passphrase, salt, iterations)
+		c.keys[id] = k
+	}
+	return k
+}
+
+// Encrypt returns the content of an encrypted secret file.
+func (c *Cipher) Encrypt(plaintext []byte) ([]byte, error) {
+	if c.salt == nil {
+		salt, err := randomBytes(saltLength)
+		if err != nil {
+			return nil, err
+		}
+		c.salt = salt
+	}
+	data, err := seal(c.key(c.salt, kdfIterations), plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting secret: %w", err)
+	}
+	content, err := json.MarshalIndent(encryptedFile{
+		Version:    encryptedVersion,
+		KDF:        kdfName,
+		Iterations: kdfIterations,
+		Salt:       c.salt,
+		Data:       data,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshalling encrypted secret: %w", err)
+	}
+	return append(content, '\n'), nil
+}
+
+// Decrypt returns the plaintext of an encrypted secret file.
+func (c *Cipher) Decrypt(content []byte) ([]byte, error) {
+	var f encryptedFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("unmarshalling encrypted secret: %w", err)
+	}
+	if f.Version != encryptedVersion {
+		return nil, fmt.Errorf("unsupported version %d", f.Version)
+	}
+	if err := checkKDF(f.KDF, f.Iterations, f.Salt); err != nil {
+		return nil, err
+	}
+	plaintext, err := open(c.key(f.Salt, f.Iterations), f.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secret: %w", err)
+	}
+	return plaintext, nil
+}
+
+// DecryptFile reads and decrypts the encrypted secret file.
+func (c *Cipher) DecryptFile(filename string) ([]byte, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading encrypted secret file %q: %w", filename, err)
+	}
+	plaintext, err := c.Decrypt(content)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted secret file %q: %w", filename, err)
+	}
+	return plaintext, nil
+}
+
+// encryptedFileSource reads an encrypted secret file with the passphrase from
+// the environment.
+type encryptedFileSource struct {
+	filename string
+
+	mu     sync.Mutex
+	cipher *Cipher
+}
+
+func (s *encryptedFileSource) Read() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cipher == nil {
+		passphrase, err := KeystorePassphrase()
+		if err != nil {
+			return nil, fmt.Errorf("decrypting secret file %q: %w", s.filename, err)
+		}
+		s.cipher = NewCipher(passphrase)
+	}
+	return s.cipher.DecryptFile(s.filename)
+}
+
+// isEncrypted reports whether the file name is an encrypted secret file.
+func isEncrypted(filename string) bool {
+	return strings.HasSuffix(filename, EncryptedSuffix)
+}
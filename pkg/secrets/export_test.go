@@ -0,0 +1,15 @@
+package secrets
+
+// DeriveKey is exported for tests.
+var DeriveKey = deriveKey
+
+// SetShmDir sets the shared memory tmpfs for temporary plaintext files.
+func SetShmDir(dir string) {
+	shmDir = dir
+}
+
+func init() {
+	// Tests do not need a slow key derivation.
+	kdfIterations = 1000
+	kdfMinIterations = 1000
+}
@@ -0,0 +1,168 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// KeystorePassphraseEnv is the environment variable with the passphrase
+	// of keystores.
+	KeystorePassphraseEnv = "OPENSLIDES_KEYSTORE_PASSPHRASE"
+
+	// KeystorePassphraseFileEnv is the environment variable with the path of
+	// a file containing the passphrase of keystores. It takes precedence over
+	// KeystorePassphraseEnv.
+	KeystorePassphraseFileEnv = "OPENSLIDES_KEYSTORE_PASSPHRASE_FILE"
+
+	keystoreVersion = 1
+)
+
+// Keystore is a file with named secrets encrypted with a key derived from a
+// passphrase. The names are stored in plaintext.
+type Keystore struct {
+	key  []byte
+	file keystoreFile
+}
+
+type keystoreFile struct {
+	Version    int               `json:"version"`
+	KDF        string            `json:"kdf"`
+	Iterations int               `json:"iterations"`
+	Salt       []byte            `json:"salt"`
+	Secrets    map[string][]byte `json:"secrets"`
+}
+
+// NewKeystore returns a new empty keystore with a fresh salt.
+func NewKeystore(passphrase []byte) (*Keystore, error) {
+	salt, err := randomBytes(saltLength)
+	if err != nil {
+		return nil, err
+	}
+	return &Keystore{
+		key: deriveKey(passphrase, salt, kdfIterations),
+		file: keystoreFile{
+			Version:    keystoreVersion,
+			KDF:        kdfName,
+			Iterations: kdfIterations,
+			Salt:       salt,
+			Secrets:    make(map[string][]byte),
+		},
+	}, nil
+}
+
+// ReadKeystore reads and unlocks the keystore file. The passphrase is checked
+// against the first secret.
+func ReadKeystore(filename string, passphrase []byte) (*Keystore, error) {
+	f, err := readKeystoreFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keystore{key: deriveKey(passphrase, f.Salt, f.Iterations), file: f}
+	if names := k.Names(); len(names) > 0 {
+		if _, err := k.Get(names[0]); err != nil {
+			return nil, fmt.Errorf("unlocking keystore file %q: %w", filename, err)
+		}
+	}
+	return k, nil
+}
+
+func readKeystoreFile(filename string) (keystoreFile, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return keystoreFile{}, fmt.Errorf("reading keystore file %q: %w", filename, err)
+	}
+	var f keystoreFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		return keystoreFile{}, fmt.Errorf("unmarshalling keystore file %q: %w", filename, err)
+	}
+	if f.Version != keystoreVersion {
+		return keystoreFile{}, fmt.Errorf("keystore file %q: unsupported version %d", filename, f.Version)
+	}
+	if err := checkKDF(f.KDF, f.Iterations, f.Salt); err != nil {
+		return keystoreFile{}, fmt.Errorf("keystore file %q: %w", filename, err)
+	}
+	if f.Secrets == nil {
+		f.Secrets = make(map[string][]byte)
+	}
+	return f, nil
+}
+
+// Names returns the sorted names of all secrets.
+func (k *Keystore) Names() []string {
+	names := make([]string, 0, len(k.file.Secrets))
+	for name := range k.file.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the decrypted secret.
+func (k *Keystore) Get(name string) ([]byte, error) {
+	data, ok := k.file.Secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("secret %q not found in keystore", name)
+	}
+	value, err := open(k.key, data)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secret %q: %w", name, err)
+	}
+	return value, nil
+}
+
+// Set encrypts and stores the secret. An existing secret with the same name is
+// replaced.
+func (k *Keystore) Set(name string, value []byte) error {
+	if name == "" || strings.ContainsAny(name, "#/") {
+		return fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := seal(k.key, value)
+	if err != nil {
+		return fmt.Errorf("encrypting secret %q: %w", name, err)
+	}
+	k.file.Secrets[name] = data
+	return nil
+}
+
+// Delete removes the secret.
+func (k *Keystore) Delete(name string) {
+	delete(k.file.Secrets, name)
+}
+
+// Write writes the keystore to the file. The file is only readable by the
+// owner.
+func (k *Keystore) Write(filename string) error {
+	content, err := json.MarshalIndent(k.file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling keystore: %w", err)
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, append(content, '\n'), 0600); err != nil {
+		return fmt.Errorf("writing keystore file %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return fmt.Errorf("replacing keystore file %q: %w", filename, err)
+	}
+	return nil
+}
+
+// KeystorePassphrase returns the passphrase for keystores from the file in
+// OPENSLIDES_KEYSTORE_PASSPHRASE_FILE or from OPENSLIDES_KEYSTORE_PASSPHRASE.
+// Trailing newlines of the file are removed.
+func KeystorePassphrase() ([]byte, error) {
+	if filename := os.Getenv(KeystorePassphraseFileEnv); filename != "" {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("reading keystore passphrase file %q: %w", filename, err)
+		}
+		return []byte(strings.TrimRight(string(content), "\r\n")), nil
+	}
+	if pp, ok := os.LookupEnv(KeystorePassphraseEnv); ok && pp != "" {
+		return []byte(pp), nil
+	}
+	return nil, fmt.Errorf("no keystore passphrase given, set %s or %s", KeystorePassphraseEnv, KeystorePassphraseFileEnv)
+}
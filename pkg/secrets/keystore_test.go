@@ -0,0 +1,91 @@
+package secrets_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// Test vector from RFC 7914, section 11.
+	got := hex.EncodeToString(secrets.DeriveKey([]byte("passwd"), []byte("salt"), 1))
+	expected := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"
+	if got != expected {
+		t.Fatalf("wrong key, expected %s, got %s", expected, got)
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	filename := path.Join(t.TempDir(), "keystore.json")
+	k, err := secrets.NewKeystore([]byte("passphrase"))
+	if err != nil {
+		t.Fatalf("creating keystore: %v", err)
+	}
+	if err := k.Set("manage_auth_password", []byte("my-password")); err != nil {
+		t.Fatalf("setting secret: %v", err)
+	}
+	if err := k.Write(filename); err != nil {
+		t.Fatalf("writing keystore: %v", err)
+	}
+
+	t.Run("read", func(t *testing.T) {
+		k, err := secrets.ReadKeystore(filename, []byte("passphrase"))
+		if err != nil {
+			t.Fatalf("reading keystore: %v", err)
+		}
+		got, err := k.Get("manage_auth_password")
+		if err != nil {
+			t.Fatalf("getting secret: %v", err)
+		}
+		if string(got) != "my-password" {
+			t.Fatalf("wrong secret, expected %q, got %q", "my-password", got)
+		}
+		if _, err := k.Get("unknown"); err == nil {
+			t.Fatalf("getting unknown secret should fail but it didn't")
+		}
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		if _, err := secrets.ReadKeystore(filename, []byte("wrong")); err == nil {
+			t.Fatalf("reading keystore with wrong passphrase should fail but it didn't")
+		}
+	})
+
+	t.Run("too many iterations", func(t *testing.T) {
+		crafted := path.Join(t.TempDir(), "keystore.json")
+		writeSecret(t, crafted, string(withIterations(t, filename, 1000000000)))
+		if _, err := secrets.ReadKeystore(crafted, []byte("passphrase")); err == nil {
+			t.Fatalf("reading keystore with too many iterations should fail but it didn't")
+		}
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		if err := k.Set("a#b", nil); err == nil {
+			t.Fatalf("setting secret with invalid name should fail but it didn't")
+		}
+	})
+}
+
+// withIterations returns the content of the file with the given number of
+// key derivation iterations.
+func withIterations(t *testing.T, filename string, iterations int) []byte {
+	t.Helper()
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("reading file: %v", err)
+	}
+	var f map[string]interface{}
+	if err := json.Unmarshal(content, &f); err != nil {
+		t.Fatalf("decoding file: %v", err)
+	}
+	f["iterations"] = iterations
+	content, err = json.Marshal(f)
+	if err != nil {
+		t.Fatalf("encoding file: %v", err)
+	}
+	return content
+}
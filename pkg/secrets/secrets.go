@@ -0,0 +1,138 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+)
+
+// Provider caches secrets and reloads them if they change. When a secret
+// changes, the old value is still accepted for a grace period, so clients can
+// be switched to the new value without downtime.
+//
+// Secrets are identified by their URI, see Open.
+type Provider struct {
+	grace  time.Duration
+	logger shared.Logger
+
+	mu      sync.RWMutex
+	secrets map[string]*entry
+}
+
+type entry struct {
+	source        Source
+	current       []byte
+	previous      []byte
+	previousUntil time.Time
+}
+
+// NewProvider returns a new provider. The grace period is the time the old
+// value of a changed secret is still accepted.
+func NewProvider(grace time.Duration, logger shared.Logger) *Provider {
+	return &Provider{
+		grace:   grace,
+		logger:  logger,
+		secrets: make(map[string]*entry),
+	}
+}
+
+// Get returns the current value of the secret. It is loaded on first use.
+func (p *Provider) Get(name string) ([]byte, error) {
+	p.mu.RLock()
+	var current []byte
+	e, ok := p.secrets[name]
+	if ok {
+		// The value is replaced by Reload, so it has to be read under the
+		// lock.
+		current = e.current
+	}
+	p.mu.RUnlock()
+	if ok {
+		return current, nil
+	}
+
+	source, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+	value, err := source.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.secrets[name]; ok {
+		// Loaded in the meantime.
+		return e.current, nil
+	}
+	p.secrets[name] = &entry{source: source, current: value}
+	return value, nil
+}
+
+// Accepted returns the current value and, during the grace period after a
+// change, the previous value of the secret.
+func (p *Provider) Accepted(name string) ([][]byte, error) {
+	if _, err := p.Get(name); err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	e := p.secrets[name]
+	values := [][]byte{e.current}
+	if e.previous != nil && time.Now().Before(e.previousUntil) {
+		values = append(values, e.previous)
+	}
+	return values, nil
+}
+
+// Reload reads all secrets again and swaps changed values. Secrets that can
+// not be read keep their old value.
+func (p *Provider) Reload() {
+	p.mu.RLock()
+	names := make([]string, 0, len(p.secrets))
+	sources := make(map[string]Source, len(p.secrets))
+	for name, e := range p.secrets {
+		names = append(names, name)
+		sources[name] = e.source
+	}
+	p.mu.RUnlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := sources[name].Read()
+		if err != nil {
+			p.logger.Warningf("Reloading secret %s failed, using old value: %v", name, err)
+			continue
+		}
+
+		p.mu.Lock()
+		e := p.secrets[name]
+		if !bytes.Equal(e.current, value) {
+			e.previous = e.current
+			e.previousUntil = time.Now().Add(p.grace)
+			e.current = value
+			p.logger.Infof("Secret %s reloaded, the old value is accepted until %s", name, e.previousUntil.Format(time.RFC3339))
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Watch reloads all secrets every interval until the context is done.
+func (p *Provider) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.Reload()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package secrets_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+)
+
+func newProvider(t testing.TB, grace time.Duration) *secrets.Provider {
+	t.Helper()
+	logger, err := shared.NewLoggerWithWriter(io.Discard, "info", shared.LogFormatText)
+	if err != nil {
+		t.Fatalf("creating logger: %v", err)
+	}
+	return secrets.NewProvider(grace, logger)
+}
+
+func writeSecret(t testing.TB, name, value string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(value), 0600); err != nil {
+		t.Fatalf("writing secret: %v", err)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	name := path.Join(t.TempDir(), "secret")
+	writeSecret(t, name, "old")
+	p := newProvider(t, time.Hour)
+
+	got, err := p.Get(name)
+	if err != nil {
+		t.Fatalf("getting secret: %v", err)
+	}
+	if string(got) != "old" {
+		t.Fatalf("wrong secret, expected %q, got %q", "old", got)
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		writeSecret(t, name, "new")
+		got, _ := p.Get(name)
+		if string(got) != "old" {
+			t.Fatalf("secret should be cached until reload, got %q", got)
+		}
+	})
+
+	t.Run("reload with grace period", func(t *testing.T) {
+		p.Reload()
+		got, _ := p.Get(name)
+		if string(got) != "new" {
+			t.Fatalf("wrong secret after reload, expected %q, got %q", "new", got)
+		}
+		accepted, err := p.Accepted(name)
+		if err != nil {
+			t.Fatalf("getting accepted secrets: %v", err)
+		}
+		if len(accepted) != 2 || string(accepted[0]) != "new" || string(accepted[1]) != "old" {
+			t.Fatalf("wrong accepted secrets, got %q", accepted)
+		}
+	})
+
+	t.Run("missing file keeps old value", func(t *testing.T) {
+		os.Remove(name)
+		p.Reload()
+		got, _ := p.Get(name)
+		if string(got) != "new" {
+			t.Fatalf("wrong secret, expected %q, got %q", "new", got)
+		}
+	})
+}
+
+func TestProviderGraceExpired(t *testing.T) {
+	name := path.Join(t.TempDir(), "secret")
+	writeSecret(t, name, "old")
+	p := newProvider(t, 0)
+	if _, err := p.Get(name); err != nil {
+		t.Fatalf("getting secret: %v", err)
+	}
+
+	writeSecret(t, name, "new")
+	p.Reload()
+	accepted, err := p.Accepted(name)
+	if err != nil {
+		t.Fatalf("getting accepted secrets: %v", err)
+	}
+	if len(accepted) != 1 || !bytes.Equal(accepted[0], []byte("new")) {
+		t.Fatalf("only the new secret should be accepted, got %q", accepted)
+	}
+}
+
+func TestProviderMissing(t *testing.T) {
+	p := newProvider(t, time.Hour)
+	if _, err := p.Get(path.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("getting missing secret should fail but it didn't")
+	}
+}
+
+// TestProviderConcurrent has to be run with -race to be useful.
+func TestProviderConcurrent(t *testing.T) {
+	name := path.Join(t.TempDir(), "secret")
+	writeSecret(t, name, "value-0")
+	p := newProvider(t, time.Hour)
+	if _, err := p.Get(name); err != nil {
+		t.Fatalf("getting secret: %v", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := p.Get(name); err != nil {
+					t.Errorf("getting secret: %v", err)
+					return
+				}
+				if _, err := p.Accepted(name); err != nil {
+					t.Errorf("getting accepted values: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= 20; i++ {
+		writeSecret(t, name, fmt.Sprintf("value-%d", i))
+		p.Reload()
+	}
+	close(done)
+	wg.Wait()
+
+	got, err := p.Get(name)
+	if err != nil {
+		t.Fatalf("getting secret: %v", err)
+	}
+	if string(got) != "value-20" {
+		t.Fatalf("wrong value after reloads, got %q", got)
+	}
+}
@@ -0,0 +1,248 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// developmentPassword is the password used if environment variable
+// OPENSLIDES_DEVELOPMENT is set to one of the following values: 1, t, T, TRUE,
+// true, True.
+const developmentPassword = "openslides"
+
+const (
+	// VaultTokenEnv is the environment variable with the token that is sent
+	// to HTTP secret endpoints in the header X-Vault-Token.
+	VaultTokenEnv = "VAULT_TOKEN"
+
+	httpTimeout = 10 * time.Second
+)
+
+// Source returns the value of a secret.
+type Source interface {
+	Read() ([]byte, error)
+}
+
+// Open returns the source for the given URI:
+//
+//	/run/secrets/name or file:///run/secrets/name  file
+//	/path/to/secrets/name.enc                      encrypted file
+//	env://NAME                                     environment variable
+//	keystore:///path/to/keystore#name              secret in an encrypted keystore
+//	http://host/path or https://host/path          HTTP endpoint
+//
+// HTTP endpoints have to return the secret as response body. If the URI has a
+// fragment like https://vault:8200/v1/secret/data/manage#password, the body is
+// decoded as JSON and the field with this name is used. It is looked up in
+// data.data (Vault KV version 2), data (version 1) and on top level. Plain
+// http is only allowed for loopback hosts, so the Vault token is never sent
+// unencrypted over the network.
+//
+// Files with the suffix .enc are decrypted with the passphrase for keystores.
+func Open(uri string) (Source, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		scheme, rest = "file", uri
+	}
+
+	switch scheme {
+	case "file":
+		if isEncrypted(rest) {
+			return &encryptedFileSource{filename: rest}, nil
+		}
+		return fileSource(rest), nil
+
+	case "env":
+		if rest == "" {
+			return nil, fmt.Errorf("invalid secret URI %q: missing name of environment variable", uri)
+		}
+		return envSource(rest), nil
+
+	case "keystore":
+		filename, name, _ := strings.Cut(rest, "#")
+		if filename == "" || name == "" {
+			return nil, fmt.Errorf("invalid secret URI %q: expected keystore:///path/to/keystore#name", uri)
+		}
+		return &keystoreSource{filename: filename, name: name}, nil
+
+	case "http", "https":
+		u, field, _ := strings.Cut(uri, "#")
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret URI %q: %w", uri, err)
+		}
+		if scheme == "http" && !isLoopback(parsed.Hostname()) {
+			return nil, fmt.Errorf("invalid secret URI %q: plain http is only allowed for loopback hosts, use https", uri)
+		}
+		return httpSource{url: u, field: field}, nil
+
+	default:
+		return nil, fmt.Errorf("invalid secret URI %q: unknown scheme %q", uri, scheme)
+	}
+}
+
+// Read returns the value of the secret with the given URI.
+func Read(uri string) ([]byte, error) {
+	s, err := Open(uri)
+	if err != nil {
+		return nil, err
+	}
+	return s.Read()
+}
+
+// AuthSecret returns the secret with the given URI. In case of development it
+// uses the development password.
+func AuthSecret(uri string, devEnv string) ([]byte, error) {
+	if dev, _ := strconv.ParseBool(devEnv); dev {
+		// Error value does not matter here. In case of an error dev is false and
+		// this is the expected behavior.
+		return []byte(developmentPassword), nil
+	}
+	return Read(uri)
+}
+
+type fileSource string
+
+func (s fileSource) Read() ([]byte, error) {
+	value, err := os.ReadFile(string(s))
+	if err != nil {
+		return nil, fmt.Errorf("reading secret file %q: %w", string(s), err)
+	}
+	return value, nil
+}
+
+type envSource string
+
+func (s envSource) Read() ([]byte, error) {
+	value, ok := os.LookupEnv(string(s))
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", string(s))
+	}
+	return []byte(value), nil
+}
+
+// keystoreSource reads a secret from a keystore. The derived key is cached
+// until the salt of the keystore changes, because the key derivation is
+// expensive on purpose.
+type keystoreSource struct {
+	filename string
+	name     string
+
+	mu         sync.Mutex
+	salt       []byte
+	iterations int
+	key        []byte
+}
+
+func (s *keystoreSource) Read() ([]byte, error) {
+	f, err := readKeystoreFile(s.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key == nil || !bytes.Equal(s.salt, f.Salt) || s.iterations != f.Iterations {
+		passphrase, err := KeystorePassphrase()
+		if err != nil {
+			return nil, fmt.Errorf("unlocking keystore file %q: %w", s.filename, err)
+		}
+		s.key = deriveKey(passphrase, f.Salt, f.Iterations)
+		s.salt = f.Salt
+		s.iterations = f.Iterations
+	}
+
+	k := &Keystore{key: s.key, file: f}
+	value, err := k.Get(s.name)
+	if err != nil {
+		return nil, fmt.Errorf("keystore file %q: %w", s.filename, err)
+	}
+	return value, nil
+}
+
+// isLoopback reports whether the host is localhost or a loopback address.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type httpSource struct {
+	url   string
+	field string
+}
+
+func (s httpSource) Read() ([]byte, error) {
+	req, err := http.NewRequest("GET", s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request to %s: %w", s.url, err)
+	}
+	if token := os.Getenv(VaultTokenEnv); token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	// Redirects are not followed, because the token would be sent to the new
+	// location.
+	client := http.Client{
+		Timeout: httpTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading secret from %s: %w", s.url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("requesting secret from %s: got response %q", s.url, resp.Status)
+	}
+	if s.field == "" {
+		return body, nil
+	}
+
+	var content struct {
+		Data struct {
+			Data map[string]json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	var v1, top map[string]json.RawMessage
+	if err := json.Unmarshal(body, &top); err != nil {
+		return nil, fmt.Errorf("decoding secret from %s: %w", s.url, err)
+	}
+	// Errors are ignored, the data fields are just not used then.
+	json.Unmarshal(body, &content)
+	if data, ok := top["data"]; ok {
+		json.Unmarshal(data, &v1)
+	}
+
+	for _, fields := range []map[string]json.RawMessage{content.Data.Data, v1, top} {
+		raw, ok := fields[s.field]
+		if !ok {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("secret field %q from %s is not a string", s.field, s.url)
+		}
+		return []byte(value), nil
+	}
+	return nil, fmt.Errorf("secret field %q not found in response from %s", s.field, s.url)
+}
@@ -0,0 +1,105 @@
+package secrets_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
+)
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	filename := path.Join(dir, "secret")
+	writeSecret(t, filename, "file-secret")
+
+	t.Setenv("TEST_SECRET", "env-secret")
+
+	keystore := path.Join(dir, "keystore.json")
+	k, err := secrets.NewKeystore([]byte("passphrase"))
+	if err != nil {
+		t.Fatalf("creating keystore: %v", err)
+	}
+	if err := k.Set("name", []byte("keystore-secret")); err != nil {
+		t.Fatalf("setting secret: %v", err)
+	}
+	if err := k.Write(keystore); err != nil {
+		t.Fatalf("writing keystore: %v", err)
+	}
+	t.Setenv(secrets.KeystorePassphraseEnv, "passphrase")
+
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/manage":
+			fmt.Fprint(w, `{"data":{"data":{"password":"vault-secret"},"metadata":{"version":1}}}`)
+		case "/v1/kv/manage":
+			fmt.Fprint(w, `{"data":{"password":"vault-v1-secret"}}`)
+		case "/raw":
+			fmt.Fprint(w, "raw-secret")
+		case "/redirect":
+			http.Redirect(w, r, "/raw", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv(secrets.VaultTokenEnv, "vault-token")
+
+	for _, tt := range []struct {
+		uri      string
+		expected string
+	}{
+		{filename, "file-secret"},
+		{"file://" + filename, "file-secret"},
+		{"env://TEST_SECRET", "env-secret"},
+		{"keystore://" + keystore + "#name", "keystore-secret"},
+		{vault.URL + "/v1/secret/data/manage#password", "vault-secret"},
+		{vault.URL + "/v1/kv/manage#password", "vault-v1-secret"},
+		{vault.URL + "/raw", "raw-secret"},
+	} {
+		t.Run(tt.uri, func(t *testing.T) {
+			got, err := secrets.Read(tt.uri)
+			if err != nil {
+				t.Fatalf("reading secret: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Fatalf("wrong secret, expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	for _, uri := range []string{
+		path.Join(dir, "missing"),
+		"env://MISSING_TEST_SECRET",
+		"env://",
+		"keystore://" + keystore,
+		"keystore://" + keystore + "#missing",
+		vault.URL + "/v1/secret/data/manage#missing",
+		vault.URL + "/missing",
+		vault.URL + "/redirect",
+		"http://vault:8200/v1/secret/data/manage#password",
+		"ftp://example.com/secret",
+	} {
+		t.Run("invalid "+uri, func(t *testing.T) {
+			if _, err := secrets.Read(uri); err == nil {
+				t.Fatalf("reading secret should fail but it didn't")
+			}
+		})
+	}
+}
+
+func TestAuthSecretDevelopment(t *testing.T) {
+	got, err := secrets.AuthSecret("env://MISSING_TEST_SECRET", "true")
+	if err != nil {
+		t.Fatalf("getting auth secret: %v", err)
+	}
+	if string(got) != "openslides" {
+		t.Fatalf("wrong development password, got %q", got)
+	}
+}
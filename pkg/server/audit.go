@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"github.com/ghodss/yaml"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// redacted replaces the values of sensitive fields in logs.
+const redacted = "[REDACTED]"
+
+// redactor removes the values of sensitive fields from requests before they
+// are logged.
+type redactor map[string]bool
+
+func newRedactor(fields []string) redactor {
+	r := make(redactor, len(fields))
+	for _, f := range fields {
+		r[f] = true
+	}
+	return r
+}
+
+// request returns the given request as JSON object with redacted sensitive
+// fields. The payload of actions is decoded, so fields inside the payload are
+// redacted, too.
+func (r redactor) request(req interface{}) interface{} {
+	encReq, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Sprintf("unable to encode request: %v", err)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(encReq, &v); err != nil {
+		return fmt.Sprintf("unable to decode request: %v", err)
+	}
+	switch in := req.(type) {
+	case *proto.ActionRequest:
+		v["payload"] = decodePayload(in.Payload)
+	case *proto.InitialDataRequest:
+		if in.Data != nil {
+			v["data"] = decodePayload(in.Data)
+		}
+	}
+	return r.redact(v)
+}
+
+// redact replaces the values of sensitive fields in the given value
+// recursively.
+func (r redactor) redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if r[k] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = r.redact(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = r.redact(e)
+		}
+	}
+	return v
+}
+
+// decodePayload decodes the YAML or JSON payload of an action or initial
+// data.
+func decodePayload(payload []byte) interface{} {
+	var v interface{}
+	if err := yaml.Unmarshal(payload, &v); err != nil {
+		return "unable to decode payload"
+	}
+	return v
+}
+
+// affectedIDs returns the ids of the objects changed by the request.
+func affectedIDs(req, resp interface{}) []int {
+	var ids []int
+	switch in := req.(type) {
+	case *proto.SetPasswordRequest:
+		ids = append(ids, int(in.UserID))
+	case *proto.ActionRequest:
+		ids = append(ids, payloadIDs(decodePayload(in.Payload))...)
+	}
+	switch out := resp.(type) {
+	case *proto.CreateUserResponse:
+		ids = append(ids, int(out.UserID))
+	case *proto.ActionResponse:
+		ids = append(ids, payloadIDs(decodePayload(out.Payload))...)
+	}
+	return ids
+}
+
+// payloadIDs returns the id fields of all objects in an action payload or an
+// action result.
+func payloadIDs(v interface{}) []int {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	var ids []int
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if id, ok := obj["id"].(float64); ok {
+			ids = append(ids, int(id))
+		}
+	}
+	return ids
+}
+
+// auditEntry is one line in the audit log.
+type auditEntry struct {
+	Time       time.Time   `json:"time"`
+	Token      string      `json:"token"`
+	Peer       string      `json:"peer"`
+	RPC        string      `json:"rpc"`
+	Action     string      `json:"action,omitempty"`
+	IDs        []int       `json:"ids,omitempty"`
+	Request    interface{} `json:"request"`
+	Result     string      `json:"result"`
+	Error      string      `json:"error,omitempty"`
+	DurationMS int64       `json:"duration_ms"`
+}
+
+// auditLogger writes audit entries as JSON lines.
+type auditLogger struct {
+	mu       sync.Mutex
+	w        io.Writer
+	redactor redactor
+}
+
+// openAuditLog returns an audit logger for the given destination. It is
+// "stdout" or the path of a file. The file is created if it does not exist.
+// The second return value closes the file.
+func openAuditLog(dest string, r redactor) (*auditLogger, func() error, error) {
+	if dest == "stdout" {
+		return &auditLogger{w: os.Stdout, redactor: r}, func() error { return nil }, nil
+	}
+	f, err := os.OpenFile(dest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening audit log file: %w", err)
+	}
+	return &auditLogger{w: f, redactor: r}, f.Close, nil
+}
+
+func (a *auditLogger) write(e auditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshalling audit entry: %w", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+	return nil
+}
+
+// callInfo contains data about the current call that is collected by inner
+// interceptors.
+type callInfo struct {
+	token string
+}
+
+type contextKey int
+
+const callInfoKey contextKey = iota
+
+// callInfoFromContext returns the call info of the context. It returns a
+// dummy if there is none, so it can always be written to.
+func callInfoFromContext(ctx context.Context) *callInfo {
+	if ci, ok := ctx.Value(callInfoKey).(*callInfo); ok {
+		return ci
+	}
+	return new(callInfo)
+}
+
+// auditUnaryInterceptor writes an entry to the audit log for every call
+// including failed authentications.
+func auditUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	s, ok := info.Server.(*srv)
+	if !ok || s.audit == nil || path.Base(info.FullMethod) == "Health" {
+		return handler(ctx, req)
+	}
+
+	a := s.audit
+	ci := new(callInfo)
+	start := time.Now()
+	resp, err := handler(context.WithValue(ctx, callInfoKey, ci), req)
+
+	e := auditEntry{
+		Time:       start.UTC(),
+		Token:      ci.token,
+		RPC:        info.FullMethod,
+		Request:    a.redactor.request(req),
+		Result:     "OK",
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		e.Peer = p.Addr.String()
+	}
+	if in, ok := req.(*proto.ActionRequest); ok {
+		e.Action = in.Action
+	}
+	if err != nil {
+		s, _ := status.FromError(statusError(err))
+		e.Result = s.Code().String()
+		e.Error = err.Error()
+	} else {
+		e.IDs = affectedIDs(req, resp)
+	}
+	if wErr := a.write(e); wErr != nil {
+		shared.LoggerFromContext(ctx).Errorf("Writing audit log: %v", wErr)
+	}
+	return resp, err
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"io"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"google.golang.org/grpc"
+)
+
+// Unexported functions for tests.
+var (
+	RecoveryUnaryInterceptor = recoveryUnaryInterceptor
+	ParseDeadlines           = parseDeadlines
+	Listen                   = listen
+	PeerName                 = peerName
+)
+
+// Intercept runs the handler through all interceptors of a server created
+// from the config. The audit log is written to audit.
+func Intercept(ctx context.Context, cfg *Config, audit io.Writer, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	logger, err := shared.NewLoggerWithWriter(io.Discard, "info", shared.LogFormatText)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newServer(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.audit = &auditLogger{w: audit, redactor: s.redactor}
+	info := &grpc.UnaryServerInfo{Server: s, FullMethod: method}
+	return chainUnaryInterceptors(unaryInterceptors)(ctx, req, info, handler)
+}
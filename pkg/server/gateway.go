@@ -0,0 +1,456 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/pkg/tracing"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const (
+	// gatewayMaxBody is the maximum size of a request body for initial data,
+	// which may be large.
+	gatewayMaxBody = 64 << 20
+
+	// gatewayMaxSmallBody is the maximum size of the request body of all
+	// other routes.
+	gatewayMaxSmallBody = 1 << 20
+)
+
+// gateway maps HTTP/JSON requests to the procedures of the manage service.
+// Every request runs through the same interceptors as a gRPC call, so
+// authentication, permissions, logging and the audit log are the same.
+//
+// Clients send the password or token in the header "Authorization: Bearer
+// <token>" or base64 encoded like gRPC clients.
+type gateway struct {
+	srv         *srv
+	interceptor grpc.UnaryServerInterceptor
+	methods     map[string]grpc.MethodDesc
+}
+
+func newGateway(s *srv, interceptors []grpc.UnaryServerInterceptor) *gateway {
+	methods := make(map[string]grpc.MethodDesc)
+	for _, m := range proto.Manage_ServiceDesc.Methods {
+		methods[m.MethodName] = m
+	}
+	return &gateway{
+		srv:         s,
+		interceptor: chainUnaryInterceptors(interceptors),
+		methods:     methods,
+	}
+}
+
+// chainUnaryInterceptors combines the interceptors like
+// grpc.ChainUnaryInterceptor. The first one is the outermost.
+func chainUnaryInterceptors(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		h := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], h
+			h = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return h(ctx, req)
+	}
+}
+
+// gatewayTLSConfig returns a TLS configuration for HTTP/1.1 with the
+// certificates of the given gRPC TLS configuration.
+func gatewayTLSConfig(base *tls.Config) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := base.GetConfigForClient(hello)
+			if err != nil {
+				return nil, err
+			}
+			c = c.Clone()
+			c.NextProtos = []string{"http/1.1"}
+			return c, nil
+		},
+	}
+}
+
+// route is one endpoint of the gateway. The request function builds the gRPC
+// request from the HTTP request and the path parameter. The result function
+// builds the JSON result from the gRPC response.
+type route struct {
+	method  string
+	prefix  string
+	param   bool
+	rpc     string
+	request func(r *http.Request, param string) (interface{}, error)
+	result  func(resp interface{}) interface{}
+}
+
+var gatewayRoutes = []route{
+	{
+		method:  http.MethodGet,
+		prefix:  "/v1/health",
+		rpc:     "Health",
+		request: func(*http.Request, string) (interface{}, error) { return &proto.HealthRequest{}, nil },
+		result: func(resp interface{}) interface{} {
+			return map[string]bool{"healthy": resp.(*proto.HealthResponse).Healthy}
+		},
+	},
+	{
+		method:  http.MethodGet,
+		prefix:  "/v1/version",
+		rpc:     "Version",
+		request: func(*http.Request, string) (interface{}, error) { return &proto.VersionRequest{}, nil },
+		result: func(resp interface{}) interface{} {
+			return map[string]string{"version": strings.TrimSpace(resp.(*proto.VersionResponse).Version)}
+		},
+	},
+	{
+		method:  http.MethodGet,
+		prefix:  "/v1/check-server",
+		rpc:     "CheckServer",
+		request: func(*http.Request, string) (interface{}, error) { return &proto.CheckServerRequest{}, nil },
+		result: func(resp interface{}) interface{} {
+			return map[string]bool{"ready": resp.(*proto.CheckServerResponse).Ready}
+		},
+	},
+	{
+		method: http.MethodPost,
+		prefix: "/v1/initial-data",
+		rpc:    "InitialData",
+		request: func(r *http.Request, _ string) (interface{}, error) {
+			body, err := readBody(r, gatewayMaxBody)
+			if err != nil {
+				return nil, err
+			}
+			return &proto.InitialDataRequest{Data: body}, nil
+		},
+		result: func(resp interface{}) interface{} {
+			return map[string]bool{"initialized": resp.(*proto.InitialDataResponse).Initialized}
+		},
+	},
+	{
+		method: http.MethodPost,
+		prefix: "/v1/migrations/",
+		param:  true,
+		rpc:    "Migrations",
+		request: func(_ *http.Request, command string) (interface{}, error) {
+			return &proto.MigrationsRequest{Command: command}, nil
+		},
+		result: func(resp interface{}) interface{} {
+			return output.RawJSON(resp.(*proto.MigrationsResponse).Response)
+		},
+	},
+	{
+		method: http.MethodPost,
+		prefix: "/v1/users",
+		rpc:    "CreateUser",
+		request: func(r *http.Request, _ string) (interface{}, error) {
+			body, err := readBody(r, gatewayMaxSmallBody)
+			if err != nil {
+				return nil, err
+			}
+			in := new(proto.CreateUserRequest)
+			if err := protojson.Unmarshal(body, in); err != nil {
+				return nil, fmt.Errorf("decoding user: %w", err)
+			}
+			return in, nil
+		},
+		result: func(resp interface{}) interface{} {
+			return map[string]int64{"user_id": resp.(*proto.CreateUserResponse).UserID}
+		},
+	},
+	{
+		method: http.MethodPut,
+		prefix: "/v1/users/",
+		param:  true,
+		rpc:    "SetPassword",
+		request: func(r *http.Request, param string) (interface{}, error) {
+			// The path is /v1/users/{id}/password.
+			if !strings.HasSuffix(param, "/password") {
+				return nil, errGatewayNotFound
+			}
+			id := strings.TrimSuffix(param, "/password")
+			userID, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid user id %q", id)
+			}
+			body, err := readBody(r, gatewayMaxSmallBody)
+			if err != nil {
+				return nil, err
+			}
+			var content struct {
+				Password string `json:"password"`
+			}
+			if err := json.Unmarshal(body, &content); err != nil {
+				return nil, fmt.Errorf("decoding body: %w", err)
+			}
+			return &proto.SetPasswordRequest{UserID: userID, Password: content.Password}, nil
+		},
+		result: func(interface{}) interface{} { return struct{}{} },
+	},
+	{
+		method: http.MethodPost,
+		prefix: "/v1/actions/",
+		param:  true,
+		rpc:    "Action",
+		request: func(r *http.Request, name string) (interface{}, error) {
+			body, err := readBody(r, gatewayMaxSmallBody)
+			if err != nil {
+				return nil, err
+			}
+			return &proto.ActionRequest{Action: name, Payload: body}, nil
+		},
+		result: func(resp interface{}) interface{} {
+			return output.RawJSON(resp.(*proto.ActionResponse).Payload)
+		},
+	},
+	{
+		method: http.MethodGet,
+		prefix: "/v1/get/",
+		param:  true,
+		rpc:    "Get",
+		request: func(r *http.Request, collection string) (interface{}, error) {
+			// Example: /v1/get/user?filter=username=admin&fields=id,username
+			q := r.URL.Query()
+			in := &proto.GetRequest{
+				Collection: collection,
+				FilterRaw:  q.Get("filter_raw"),
+			}
+			if e := q.Get("exists"); e != "" {
+				exists, err := strconv.ParseBool(e)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value for exists: %w", err)
+				}
+				in.Exists = exists
+			}
+			for _, f := range q["filter"] {
+				key, value, ok := strings.Cut(f, "=")
+				if !ok {
+					return nil, fmt.Errorf("invalid filter %q, expected key=value", f)
+				}
+				if in.Filter == nil {
+					in.Filter = make(map[string]string)
+				}
+				in.Filter[key] = value
+			}
+			for _, f := range q["fields"] {
+				in.Fields = append(in.Fields, splitList(f)...)
+			}
+			return in, nil
+		},
+		result: func(resp interface{}) interface{} {
+			return output.RawJSON([]byte(resp.(*proto.GetResponse).Value))
+		},
+	},
+}
+
+var errGatewayNotFound = errors.New("not found")
+
+// match returns the path parameter if the route matches the request path.
+func (rt route) match(urlPath string) (string, bool) {
+	if !rt.param {
+		return "", urlPath == rt.prefix
+	}
+	if !strings.HasPrefix(urlPath, rt.prefix) || urlPath == rt.prefix {
+		return "", false
+	}
+	return strings.TrimPrefix(urlPath, rt.prefix), true
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, _ := output.New(w, output.FormatJSON) // The format is valid.
+
+	var pathMatched bool
+	for _, rt := range gatewayRoutes {
+		param, ok := rt.match(r.URL.Path)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if r.Method != rt.method {
+			continue
+		}
+
+		ctx := gatewayContext(w, r)
+
+		// The body is only read for authenticated clients, so others can not
+		// make the server buffer large requests.
+		if err := g.preAuth(ctx, rt.rpc); err != nil {
+			writeGatewayError(w, p, g.reject(ctx, rt.rpc, err))
+			return
+		}
+
+		in, err := rt.request(r, param)
+		if err != nil {
+			if err == errGatewayNotFound {
+				pathMatched = false
+				break
+			}
+			writeGatewayError(w, p, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+
+		resp, err := g.call(ctx, rt.rpc, in)
+		if err != nil {
+			writeGatewayError(w, p, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		p.Result(rt.result(resp))
+		return
+	}
+
+	if pathMatched {
+		writeGatewayError(w, p, status.Errorf(codes.Unimplemented, "method %s not allowed for %s", r.Method, r.URL.Path))
+		return
+	}
+	writeGatewayError(w, p, status.Errorf(codes.NotFound, "unknown path %s", r.URL.Path))
+}
+
+// gatewayContext returns the context for the call with the metadata of the
+// HTTP request. The request id is taken from the request or created and
+// returned in the response header.
+func gatewayContext(w http.ResponseWriter, r *http.Request) context.Context {
+	id := r.Header.Get(shared.RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	w.Header().Set(shared.RequestIDHeader, id)
+
+	md := metadata.Pairs(requestIDKey, id)
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if strings.HasPrefix(auth, "Bearer ") {
+			auth = base64.StdEncoding.EncodeToString([]byte(strings.TrimPrefix(auth, "Bearer ")))
+		}
+		md.Set("authorization", auth)
+	}
+	if tp := r.Header.Get(tracing.TraceparentHeader); tp != "" {
+		md.Set(tracing.TraceparentHeader, tp)
+	}
+
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	return peer.NewContext(ctx, &peer.Peer{Addr: gatewayAddr(r.RemoteAddr)})
+}
+
+// preAuth checks the auth lockout, the password and the rate limit before the
+// request body is read. It has no side effects, the interceptors check
+// everything again for the call.
+func (g *gateway) preAuth(ctx context.Context, rpc string) error {
+	if err := g.srv.checkAuthLimit(ctx); err != nil {
+		return fmt.Errorf("server authentication: %w", err)
+	}
+	if _, err := g.srv.serverAuth(ctx); err != nil {
+		return fehler.WithCode(codes.Unauthenticated, fmt.Errorf("server authentication: %w", err))
+	}
+	if b, ok := g.srv.rateLimits[rpc]; ok && !b.available(time.Now()) {
+		return fehler.WithCode(codes.ResourceExhausted, fmt.Errorf("rate limit of %s exceeded", rpc))
+	}
+	return nil
+}
+
+// reject runs the interceptors for a call that failed preAuth without a
+// request, so the rejection is counted, logged and audited like any other. The
+// procedure itself is never called.
+func (g *gateway) reject(ctx context.Context, rpc string, err error) error {
+	info := &grpc.UnaryServerInfo{
+		Server:     g.srv,
+		FullMethod: "/" + proto.Manage_ServiceDesc.ServiceName + "/" + rpc,
+	}
+	_, iErr := g.interceptor(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, err
+	})
+	return iErr
+}
+
+// call invokes the procedure like the gRPC server including all interceptors.
+func (g *gateway) call(ctx context.Context, rpc string, in interface{}) (interface{}, error) {
+	dec := func(v interface{}) error {
+		protobuf.Merge(v.(protobuf.Message), in.(protobuf.Message))
+		return nil
+	}
+	return g.methods[rpc].Handler(g.srv, ctx, dec, g.interceptor)
+}
+
+// writeGatewayError writes the error document with the HTTP status for the
+// gRPC status code of the error.
+func writeGatewayError(w http.ResponseWriter, p *output.Printer, err error) {
+	gErr := fehler.FromGRPC(err)
+	code := fehler.ExitGeneral
+	var errExit interface {
+		ExitCode() int
+	}
+	if errors.As(gErr, &errExit) {
+		code = errExit.ExitCode()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus(status.Code(err)))
+	p.Error(gErr, code)
+}
+
+// httpStatus maps a gRPC status code to a HTTP status code.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusMethodNotAllowed
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Canceled:
+		return 499 // Client closed request
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// readBody reads the request body up to max bytes.
+func readBody(r *http.Request, max int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	if int64(len(body)) > max {
+		return nil, fmt.Errorf("body is larger than %d bytes", max)
+	}
+	return body, nil
+}
+
+// gatewayAddr is the address of a HTTP client.
+type gatewayAddr string
+
+func (a gatewayAddr) Network() string { return "tcp" }
+func (a gatewayAddr) String() string  { return string(a) }
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/backendaction"
+	"github.com/OpenSlides/openslides-manage-service/pkg/checkserver"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// watchBackendHealth sets the serving status of the standard health service
+// for the whole server and for the manage service depending on the
+// reachability of the backend. It checks the backend every interval until the
+// context is done.
+func watchBackendHealth(ctx context.Context, s *srv, hs *health.Server, interval time.Duration) {
+	var last healthpb.HealthCheckResponse_ServingStatus
+	for {
+		current := healthpb.HealthCheckResponse_SERVING
+		if !backendReady(ctx, s, interval) {
+			current = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		if current != last {
+			hs.SetServingStatus("", current)
+			hs.SetServingStatus(proto.Manage_ServiceDesc.ServiceName, current)
+			if current == healthpb.HealthCheckResponse_SERVING {
+				s.logger.Infof("Backend is reachable, health status is %s", current)
+			} else {
+				s.logger.Warningf("Backend is not reachable, health status is %s", current)
+			}
+			last = current
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// backendReady calls the health route of the backend like the CheckServer
+// procedure.
+func backendReady(ctx context.Context, s *srv, timeout time.Duration) bool {
+	pw, err := s.internalPassword()
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	a := backendaction.New(s.config.ManageBackendHealthURL(), pw, backendaction.HealthRoute)
+	return checkserver.CheckServer(ctx, &proto.CheckServerRequest{}, a).Ready
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDKey is the gRPC metadata key for the request id.
+var requestIDKey = strings.ToLower(shared.RequestIDHeader)
+
+// maxRequestIDLength is the maximum length of a request id given by a client.
+const maxRequestIDLength = 64
+
+// requestID returns the request id given by the client in the metadata or a
+// new one if there is no valid id.
+func requestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDKey); len(ids) > 0 && validRequestID(ids[0]) {
+			return ids[0]
+		}
+	}
+	return newRequestID()
+}
+
+// validRequestID checks the request id given by a client, so it can be
+// logged and forwarded safely.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// recoveryUnaryInterceptor converts a panic in a handler to an error with
+// status code Internal. The stack trace is logged.
+func recoveryUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			shared.LoggerFromContext(ctx).Criticalf("Panic in %s: %v\n%s", info.FullMethod, r, debug.Stack())
+			resp = nil
+			err = fehler.WithCode(codes.Internal, fmt.Errorf("internal error in %s", info.FullMethod))
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// deadlineUnaryInterceptor limits the deadline of every call to the maximum
+// deadline of the procedure. A shorter deadline of the client is kept.
+func deadlineUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	s, ok := info.Server.(*srv)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	max, ok := s.maxDeadlines[path.Base(info.FullMethod)]
+	if !ok {
+		max = s.maxDeadlines[defaultDeadlineKey]
+	}
+	if max <= 0 {
+		return handler(ctx, req)
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= max {
+		return handler(ctx, req)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, max)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+// defaultDeadlineKey is used in MANAGE_MAX_DEADLINES for all procedures
+// without own value.
+const defaultDeadlineKey = "default"
+
+// parseDeadlines parses a comma separated list like
+// "default=5m,Migrations=1h". The keys are procedure names or "default".
+func parseDeadlines(s string) (map[string]time.Duration, error) {
+	rpcs := map[string]bool{defaultDeadlineKey: true}
+	for _, m := range proto.Manage_ServiceDesc.Methods {
+		rpcs[m.MethodName] = true
+	}
+
+	deadlines := make(map[string]time.Duration)
+	for _, e := range splitList(s) {
+		name, value, ok := strings.Cut(e, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q, expected name=duration", e)
+		}
+		name = strings.TrimSpace(name)
+		if !rpcs[name] {
+			return nil, fmt.Errorf("unknown RPC %q", name)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("parsing deadline of %s: %w", name, err)
+		}
+		deadlines[name] = d
+	}
+	return deadlines, nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const unixPrefix = "unix://"
+
+// listenAddresses returns the addresses from MANAGE_LISTEN or the TCP address
+// with MANAGE_PORT if it is empty.
+func (c *Config) listenAddresses() []string {
+	addrs := splitList(c.Listen)
+	if len(addrs) == 0 {
+		return []string{":" + c.Port}
+	}
+	return addrs
+}
+
+// LocalAddress returns the address to connect to the server on the same host.
+// It is the first listen address.
+func (c *Config) LocalAddress() string {
+	addr := c.listenAddresses()[0]
+	if strings.HasPrefix(addr, unixPrefix) {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(addr, "tcp://"))
+	if err != nil {
+		return addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// listen opens a listener for the given address. Addresses like
+// unix:///run/manage.sock are Unix domain sockets, which get the given file
+// mode. All other addresses are TCP addresses with an optional tcp:// prefix.
+func listen(addr string, socketMode string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		lis, err := net.Listen("tcp", strings.TrimPrefix(addr, "tcp://"))
+		if err != nil {
+			return nil, fmt.Errorf("listen on address %q: %w", addr, err)
+		}
+		return lis, nil
+	}
+
+	socket := strings.TrimPrefix(addr, unixPrefix)
+	if !strings.HasPrefix(socket, "/") {
+		return nil, fmt.Errorf("invalid address %q: socket path has to be absolute, e. g. unix:///run/manage.sock", addr)
+	}
+	mode, err := strconv.ParseUint(socketMode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("parsing socket mode %q: %w", socketMode, err)
+	}
+
+	// Remove a socket of a previous run. Other files are not touched.
+	if fi, err := os.Lstat(socket); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(socket); err != nil {
+			return nil, fmt.Errorf("removing old socket %q: %w", socket, err)
+		}
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("checking socket %q: %w", socket, err)
+	}
+
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("listen on address %q: %w", addr, err)
+	}
+	if err := os.Chmod(socket, fs.FileMode(mode)); err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("setting mode of socket %q: %w", socket, err)
+	}
+	return unixListener{lis}, nil
+}
+
+// unixListener sets the user id of the client process as remote address of
+// the accepted connections, so clients on the same socket can be told apart.
+type unixListener struct {
+	net.Listener
+}
+
+// Accept implements net.Listener.
+func (l unixListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, nil
+	}
+	uid, ok := peerUID(uc)
+	if !ok {
+		return conn, nil
+	}
+	return unixConn{Conn: conn, addr: unixPeerAddr{uid: uid}}, nil
+}
+
+type unixConn struct {
+	net.Conn
+	addr unixPeerAddr
+}
+
+// RemoteAddr implements net.Conn.
+func (c unixConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// unixPeerAddr is the address of a client on a Unix domain socket.
+type unixPeerAddr struct {
+	uid int
+}
+
+// Network implements net.Addr.
+func (a unixPeerAddr) Network() string {
+	return "unix"
+}
+
+// String implements net.Addr.
+func (a unixPeerAddr) String() string {
+	return "unix:uid=" + strconv.Itoa(a.uid)
+}
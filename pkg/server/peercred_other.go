@@ -0,0 +1,10 @@
+//go:build !linux
+
+package server
+
+import "net"
+
+// peerUID is only supported on Linux.
+func peerUID(conn *net.UnixConn) (int, bool) {
+	return 0, false
+}
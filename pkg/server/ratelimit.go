@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/metrics"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+)
+
+var (
+	authFailures = metrics.NewCounter(
+		"openslides_manage_auth_failures_total",
+		"Number of failed authentications.",
+	)
+	authLockouts = metrics.NewCounter(
+		"openslides_manage_auth_lockouts_total",
+		"Number of peers locked out after failed authentications.",
+	)
+	rateLimited = metrics.NewCounter(
+		"openslides_manage_rate_limited_total",
+		"Number of calls rejected by the rate limit by gRPC method.",
+		"method",
+	)
+)
+
+// authPruneInterval is the minimal time between two cleanups of old peers.
+const authPruneInterval = time.Minute
+
+// authLimiter locks out peers after failed authentications. After maxFailures
+// failures, the peer is locked out for the lockout duration. Every further
+// failure doubles the duration up to maxLockout. A successful authentication
+// resets the peer.
+type authLimiter struct {
+	maxFailures int
+	lockout     time.Duration
+	maxLockout  time.Duration
+
+	mu     sync.Mutex
+	peers  map[string]*peerState
+	pruned time.Time
+}
+
+type peerState struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// newAuthLimiter returns a limiter with the values from the config. It returns
+// nil if the limit is disabled.
+func newAuthLimiter(cfg *Config) (*authLimiter, error) {
+	maxFailures, err := strconv.Atoi(cfg.AuthMaxFailures)
+	if err != nil {
+		return nil, fmt.Errorf("parsing MANAGE_AUTH_MAX_FAILURES: %w", err)
+	}
+	if maxFailures <= 0 {
+		return nil, nil
+	}
+	lockout, err := time.ParseDuration(cfg.AuthLockout)
+	if err != nil {
+		return nil, fmt.Errorf("parsing MANAGE_AUTH_LOCKOUT: %w", err)
+	}
+	maxLockout, err := time.ParseDuration(cfg.AuthMaxLockout)
+	if err != nil {
+		return nil, fmt.Errorf("parsing MANAGE_AUTH_MAX_LOCKOUT: %w", err)
+	}
+	if maxLockout < lockout {
+		return nil, fmt.Errorf("MANAGE_AUTH_MAX_LOCKOUT (%s) is shorter than MANAGE_AUTH_LOCKOUT (%s)", maxLockout, lockout)
+	}
+	return &authLimiter{
+		maxFailures: maxFailures,
+		lockout:     lockout,
+		maxLockout:  maxLockout,
+		peers:       make(map[string]*peerState),
+	}, nil
+}
+
+// locked returns the remaining time if the peer is locked out.
+func (l *authLimiter) locked(p string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.peers[p]
+	if !ok || !now.Before(s.lockedUntil) {
+		return 0, false
+	}
+	return s.lockedUntil.Sub(now), true
+}
+
+// failure registers a failed authentication. It returns the lockout duration
+// if the peer is locked out now.
+func (l *authLimiter) failure(p string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	s, ok := l.peers[p]
+	if !ok {
+		s = new(peerState)
+		l.peers[p] = s
+	}
+	s.failures++
+	s.lastFailure = now
+	if s.failures < l.maxFailures {
+		return 0
+	}
+
+	d := l.lockout
+	for i := l.maxFailures; i < s.failures && d < l.maxLockout; i++ {
+		d *= 2
+	}
+	if d > l.maxLockout {
+		d = l.maxLockout
+	}
+	s.lockedUntil = now.Add(d)
+	return d
+}
+
+// success resets the peer.
+func (l *authLimiter) success(p string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.peers, p)
+}
+
+// prune removes peers without failures in the last maxLockout that are not
+// locked out. The caller has to hold the lock.
+func (l *authLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < authPruneInterval {
+		return
+	}
+	l.pruned = now
+	for p, s := range l.peers {
+		if now.Sub(s.lastFailure) > l.maxLockout && !now.Before(s.lockedUntil) {
+			delete(l.peers, p)
+		}
+	}
+}
+
+// peerName returns the IP address of the client. Clients on a Unix domain
+// socket are identified by their user id, e. g. "unix:uid=1000", or by "unix"
+// if it is unknown.
+func peerName(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	if a, ok := p.Addr.(unixPeerAddr); ok {
+		return a.String()
+	}
+	if p.Addr.Network() == "unix" {
+		return "unix"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// checkAuthLimit returns an error if the peer of the call is locked out.
+func (s *srv) checkAuthLimit(ctx context.Context) error {
+	if s.authLimiter == nil {
+		return nil
+	}
+	if d, ok := s.authLimiter.locked(peerName(ctx), time.Now()); ok {
+		return fehler.WithCode(codes.ResourceExhausted, fmt.Errorf("too many failed authentications, try again in %s", d.Round(time.Second)))
+	}
+	return nil
+}
+
+// authResult registers the result of an authentication for the peer of the
+// call.
+func (s *srv) authResult(ctx context.Context, err error) {
+	if s.authLimiter == nil {
+		return
+	}
+	p := peerName(ctx)
+	if err == nil {
+		s.authLimiter.success(p)
+		return
+	}
+	authFailures.Inc()
+	if d := s.authLimiter.failure(p, time.Now()); d > 0 {
+		authLockouts.Inc()
+		shared.LoggerFromContext(ctx).Warningf("Peer %s locked out for %s after failed authentications", p, d)
+	}
+}
+
+// bucket is a token bucket for the rate limit of one procedure.
+type bucket struct {
+	mu     sync.Mutex
+	max    float64
+	rate   float64 // Tokens per second
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// available reports whether a call would be allowed without using up a token.
+func (b *bucket) available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= 1
+}
+
+// parseRateLimits parses a comma separated list like
+// "SetPassword=10/m,CreateUser=100/h". The units are s, m and h. The count is
+// also the burst size.
+func parseRateLimits(s string) (map[string]*bucket, error) {
+	rpcs := make(map[string]bool)
+	for _, m := range proto.Manage_ServiceDesc.Methods {
+		rpcs[m.MethodName] = true
+	}
+	units := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+	limits := make(map[string]*bucket)
+	for _, e := range splitList(s) {
+		name, value, ok := strings.Cut(e, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q, expected name=count/unit", e)
+		}
+		name = strings.TrimSpace(name)
+		if !rpcs[name] {
+			return nil, fmt.Errorf("unknown RPC %q", name)
+		}
+		count, unit, ok := strings.Cut(strings.TrimSpace(value), "/")
+		n, err := strconv.Atoi(count)
+		if !ok || err != nil || n <= 0 || units[unit] == 0 {
+			return nil, fmt.Errorf("invalid limit %q of %s, expected count/unit with unit s, m or h", value, name)
+		}
+		limits[name] = &bucket{
+			max:    float64(n),
+			rate:   float64(n) / units[unit].Seconds(),
+			tokens: float64(n),
+			last:   time.Now(),
+		}
+	}
+	return limits, nil
+}
+
+// rateLimitUnaryInterceptor rejects calls that exceed the rate limit of the
+// procedure. It runs after the authentication, so unauthenticated calls do not
+// use up the limit.
+func rateLimitUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	s, ok := info.Server.(*srv)
+	if !ok {
+		return handler(ctx, req)
+	}
+	b, ok := s.rateLimits[path.Base(info.FullMethod)]
+	if ok && !b.allow(time.Now()) {
+		rateLimited.Inc(info.FullMethod)
+		shared.LoggerFromContext(ctx).Warningf("Rate limit of %s exceeded", info.FullMethod)
+		return nil, fehler.WithCode(codes.ResourceExhausted, fmt.Errorf("rate limit of %s exceeded", path.Base(info.FullMethod)))
+	}
+	return handler(ctx, req)
+}
@@ -2,105 +2,318 @@ package server
 
 import (
 	"context"
-	"crypto/subtle"
+	"crypto/rand"
+	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"path"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/action"
 	"github.com/OpenSlides/openslides-manage-service/pkg/backendaction"
 	"github.com/OpenSlides/openslides-manage-service/pkg/checkserver"
 	"github.com/OpenSlides/openslides-manage-service/pkg/createuser"
 	"github.com/OpenSlides/openslides-manage-service/pkg/datastorereader"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
 	"github.com/OpenSlides/openslides-manage-service/pkg/get"
 	"github.com/OpenSlides/openslides-manage-service/pkg/initialdata"
+	"github.com/OpenSlides/openslides-manage-service/pkg/metrics"
 	"github.com/OpenSlides/openslides-manage-service/pkg/migrations"
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setpassword"
 	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/pkg/tracing"
 	"github.com/OpenSlides/openslides-manage-service/pkg/version"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"golang.org/x/sys/unix"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 // Run starts the manage server.
 func Run(cfg *Config) error {
-	logger, err := shared.NewLogger(cfg.OpenSlidesLoglevel)
+	logger, err := shared.NewLogger(cfg.OpenSlidesLoglevel, cfg.LogFormat)
 	if err != nil {
 		return fmt.Errorf("creating logger: %w", err)
 	}
+	shared.SetDefaultLogger(logger)
 
-	addr := ":" + cfg.Port
-	lis, err := net.Listen("tcp", addr)
+	var listeners []net.Listener
+	defer func() {
+		for _, lis := range listeners {
+			lis.Close()
+		}
+	}()
+	for _, addr := range cfg.listenAddresses() {
+		lis, err := listen(addr, cfg.SocketMode)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, lis)
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+	}
+
+	tlsConfig, err := TLSConfig(cfg, logger)
 	if err != nil {
-		return fmt.Errorf("listen on address %q: %w", addr, err)
+		return fmt.Errorf("creating TLS configuration: %w", err)
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
 
-	grpcSrv := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			grpc.UnaryServerInterceptor(logUnaryInterceptor),
-			grpc.UnaryServerInterceptor(authUnaryInterceptor),
-		),
-	)
+	grpcSrv := grpc.NewServer(opts...)
 	manageSrv, err := newServer(cfg, logger)
 	if err != nil {
 		return fmt.Errorf("creating server object: %w", err)
 	}
 	proto.RegisterManageServer(grpcSrv, manageSrv)
 
+	// The standard health service and the reflection service can be used
+	// without authentication, e. g. by grpcurl or Kubernetes probes.
+	healthInterval, err := time.ParseDuration(cfg.HealthCheckInterval)
+	if err != nil {
+		return fmt.Errorf("parsing MANAGE_HEALTH_CHECK_INTERVAL: %w", err)
+	}
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthSrv.SetServingStatus(proto.Manage_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(grpcSrv, healthSrv)
+	reflection.Register(grpcSrv)
+
+	// Background tasks log with the server logger like the calls.
+	bgCtx, stopBackground := context.WithCancel(shared.WithLogger(context.Background(), logger))
+	defer stopBackground()
+	go watchBackendHealth(bgCtx, manageSrv, healthSrv, healthInterval)
+
+	secretPollInterval, err := time.ParseDuration(cfg.SecretPollInterval)
+	if err != nil {
+		return fmt.Errorf("parsing MANAGE_SECRET_POLL_INTERVAL: %w", err)
+	}
+	if secretPollInterval > 0 {
+		go manageSrv.secrets.Watch(bgCtx, secretPollInterval)
+	}
+	go reloadOnSIGHUP(bgCtx, manageSrv.secrets, logger)
+
+	if cfg.AuditLog != "" {
+		audit, close, err := openAuditLog(cfg.AuditLog, manageSrv.redactor)
+		if err != nil {
+			return fmt.Errorf("creating audit log: %w", err)
+		}
+		defer close()
+		manageSrv.audit = audit
+		logger.Infof("Manage service writes audit log to %s\n", cfg.AuditLog)
+	}
+
+	closeTracing, err := setupTracing(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	defer closeTracing()
+
+	var metricsSrv *http.Server
+	if cfg.MetricsPort != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsSrv = &http.Server{Addr: ":" + cfg.MetricsPort, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			logger.Infof("Metrics are served on %s/metrics\n", metricsSrv.Addr)
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("Serving metrics: %v", err)
+			}
+		}()
+	}
+
+	var gatewaySrv *http.Server
+	if cfg.GatewayPort != "" {
+		gatewayAddr := ":" + cfg.GatewayPort
+		gatewayLis, err := net.Listen("tcp", gatewayAddr)
+		if err != nil {
+			return fmt.Errorf("listen on address %q: %w", gatewayAddr, err)
+		}
+		if tlsConfig != nil {
+			gatewayLis = tls.NewListener(gatewayLis, gatewayTLSConfig(tlsConfig))
+		}
+		gatewaySrv = &http.Server{Handler: newGateway(manageSrv, unaryInterceptors), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			logger.Infof("HTTP/JSON gateway is listening on %s\n", gatewayAddr)
+			if err := gatewaySrv.Serve(gatewayLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("Serving HTTP/JSON gateway: %v", err)
+			}
+		}()
+	}
+
 	go func() {
 		waitForShutdown()
+		stopBackground()
+		healthSrv.Shutdown()
+		if metricsSrv != nil {
+			metricsSrv.Close()
+		}
+		if gatewaySrv != nil {
+			gatewaySrv.Shutdown(context.Background())
+		}
 		grpcSrv.GracefulStop()
 	}()
 
-	logger.Infof("Manage service is listening on %s\n", addr)
-	if err := grpcSrv.Serve(lis); err != nil {
-		return fmt.Errorf("running manage service: %w", err)
+	if tlsConfig != nil {
+		logger.Infof("Manage service uses TLS with certificate %s\n", cfg.TLSCertFile)
+	}
+	errs := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		logger.Infof("Manage service is listening on %s\n", lis.Addr())
+		go func(lis net.Listener) {
+			errs <- grpcSrv.Serve(lis)
+		}(lis)
+	}
+	for range listeners {
+		if err := <-errs; err != nil {
+			grpcSrv.Stop()
+			return fmt.Errorf("running manage service: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// unaryInterceptors are used for all calls via gRPC and via the HTTP/JSON
+// gateway. The first one is the outermost. The recovery is directly around the
+// handler, so a panicking call is logged and audited as Internal.
+var unaryInterceptors = []grpc.UnaryServerInterceptor{
+	tracingUnaryInterceptor,
+	logUnaryInterceptor,
+	deadlineUnaryInterceptor,
+	auditUnaryInterceptor,
+	authUnaryInterceptor,
+	rateLimitUnaryInterceptor,
+	recoveryUnaryInterceptor,
+}
+
+var (
+	rpcRequests = metrics.NewCounter(
+		"openslides_manage_rpc_requests_total",
+		"Number of calls by gRPC method and status code.",
+		"method", "code",
+	)
+	rpcDuration = metrics.NewHistogram(
+		"openslides_manage_rpc_duration_seconds",
+		"Latency of calls by gRPC method.",
+		metrics.DefaultBuckets,
+		"method",
+	)
+)
+
 // srv implements the manage methods on server side.
 type srv struct {
-	config *Config
-	pw     []byte
-	logger shared.Logger
+	config       *Config
+	tokens       []*token
+	secrets      *secrets.Provider
+	actionPolicy action.Policy
+	maxDeadlines map[string]time.Duration
+	authLimiter  *authLimiter
+	rateLimits   map[string]*bucket
+	redactor     redactor
+	audit        *auditLogger
+	logger       shared.Logger
 }
 
 func newServer(cfg *Config, logger shared.Logger) (*srv, error) {
-	pw, err := shared.AuthSecret(cfg.ManageAuthPasswordFile, cfg.OpenSlidesDevelopment)
+	grace, err := time.ParseDuration(cfg.SecretGracePeriod)
 	if err != nil {
+		return nil, fmt.Errorf("parsing MANAGE_SECRET_GRACE_PERIOD: %w", err)
+	}
+	provider := secrets.NewProvider(grace, logger)
+
+	admin := &token{Name: adminTokenName, file: cfg.ManageAuthPasswordFile}
+	if dev, _ := strconv.ParseBool(cfg.OpenSlidesDevelopment); dev {
+		pw, err := secrets.AuthSecret(cfg.ManageAuthPasswordFile, cfg.OpenSlidesDevelopment)
+		if err != nil {
+			return nil, fmt.Errorf("getting server auth secret: %w", err)
+		}
+		admin = &token{Name: adminTokenName, secret: pw}
+	} else if _, err := provider.Get(cfg.ManageAuthPasswordFile); err != nil {
 		return nil, fmt.Errorf("getting server auth secret: %w", err)
 	}
+	tokens := []*token{admin}
+	if cfg.ManageAuthTokensFile != "" {
+		t, err := loadTokens(cfg.ManageAuthTokensFile, provider)
+		if err != nil {
+			return nil, fmt.Errorf("loading manage auth tokens: %w", err)
+		}
+		tokens = append(tokens, t...)
+	}
+	policy, err := action.NewPolicy(splitList(cfg.ActionAllow), splitList(cfg.ActionDeny))
+	if err != nil {
+		return nil, fmt.Errorf("creating action policy: %w", err)
+	}
+	deadlines, err := parseDeadlines(cfg.MaxDeadlines)
+	if err != nil {
+		return nil, fmt.Errorf("parsing MANAGE_MAX_DEADLINES: %w", err)
+	}
+	authLimiter, err := newAuthLimiter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating auth limiter: %w", err)
+	}
+	rateLimits, err := parseRateLimits(cfg.RateLimits)
+	if err != nil {
+		return nil, fmt.Errorf("parsing MANAGE_RATE_LIMITS: %w", err)
+	}
 	s := &srv{
-		config: cfg,
-		pw:     pw,
-		logger: logger,
+		config:       cfg,
+		secrets:      provider,
+		authLimiter:  authLimiter,
+		rateLimits:   rateLimits,
+		tokens:       tokens,
+		actionPolicy: policy,
+		maxDeadlines: deadlines,
+		redactor:     newRedactor(splitList(cfg.AuditRedactFields)),
+		logger:       logger,
 	}
 	return s, nil
 }
 
+// internalPassword returns the password for the backend. In development mode
+// the development password is used.
+func (s *srv) internalPassword() ([]byte, error) {
+	if dev, _ := strconv.ParseBool(s.config.OpenSlidesDevelopment); dev {
+		return secrets.AuthSecret(s.config.InternalAuthPasswordFile, s.config.OpenSlidesDevelopment)
+	}
+	return s.secrets.Get(s.config.InternalAuthPasswordFile)
+}
+
 func (s *srv) CheckServer(ctx context.Context, in *proto.CheckServerRequest) (*proto.CheckServerResponse, error) {
-	pw, err := shared.AuthSecret(s.config.InternalAuthPasswordFile, s.config.OpenSlidesDevelopment)
+	pw, err := s.internalPassword()
 	if err != nil {
-		return nil, fmt.Errorf("getting internal auth password from file: %w", err)
+		return nil, fehler.WithCode(codes.Internal, fmt.Errorf("getting internal auth password from file: %w", err))
 	}
-	a := backendaction.New(s.config.manageBackendHealthURL(), pw, backendaction.HealthRoute)
+	a := backendaction.New(s.config.ManageBackendHealthURL(), pw, backendaction.HealthRoute)
 	return checkserver.CheckServer(ctx, in, a), nil // CheckServer does not return an error for better handling in the client.
 
 }
 
 func (s *srv) InitialData(ctx context.Context, in *proto.InitialDataRequest) (*proto.InitialDataResponse, error) {
-	pw, err := shared.AuthSecret(s.config.InternalAuthPasswordFile, s.config.OpenSlidesDevelopment)
+	pw, err := s.internalPassword()
 	if err != nil {
-		return nil, fmt.Errorf("getting internal auth password from file: %w", err)
+		return nil, fehler.WithCode(codes.Internal, fmt.Errorf("getting internal auth password from file: %w", err))
 	}
 	a := backendaction.New(s.config.manageBackendActionURL(), pw, backendaction.ActionRoute)
 	return initialdata.InitialData(ctx, in, s.config.SuperadminPasswordFile, a)
@@ -108,9 +321,9 @@ func (s *srv) InitialData(ctx context.Context, in *proto.InitialDataRequest) (*p
 }
 
 func (s *srv) Migrations(ctx context.Context, in *proto.MigrationsRequest) (*proto.MigrationsResponse, error) {
-	pw, err := shared.AuthSecret(s.config.InternalAuthPasswordFile, s.config.OpenSlidesDevelopment)
+	pw, err := s.internalPassword()
 	if err != nil {
-		return nil, fmt.Errorf("getting internal auth password from file: %w", err)
+		return nil, fehler.WithCode(codes.Internal, fmt.Errorf("getting internal auth password from file: %w", err))
 	}
 	a := backendaction.New(s.config.manageBackendMigrationsURL(), pw, backendaction.MigrationsRoute)
 	return migrations.Migrations(ctx, in, a)
@@ -118,35 +331,35 @@ func (s *srv) Migrations(ctx context.Context, in *proto.MigrationsRequest) (*pro
 }
 
 func (s *srv) CreateUser(ctx context.Context, in *proto.CreateUserRequest) (*proto.CreateUserResponse, error) {
-	pw, err := shared.AuthSecret(s.config.InternalAuthPasswordFile, s.config.OpenSlidesDevelopment)
+	pw, err := s.internalPassword()
 	if err != nil {
-		return nil, fmt.Errorf("getting internal auth password from file: %w", err)
+		return nil, fehler.WithCode(codes.Internal, fmt.Errorf("getting internal auth password from file: %w", err))
 	}
 	a := backendaction.New(s.config.manageBackendActionURL(), pw, backendaction.ActionRoute)
 	return createuser.CreateUser(ctx, in, a)
 }
 
 func (s *srv) SetPassword(ctx context.Context, in *proto.SetPasswordRequest) (*proto.SetPasswordResponse, error) {
-	pw, err := shared.AuthSecret(s.config.InternalAuthPasswordFile, s.config.OpenSlidesDevelopment)
+	pw, err := s.internalPassword()
 	if err != nil {
-		return nil, fmt.Errorf("getting internal auth password from file: %w", err)
+		return nil, fehler.WithCode(codes.Internal, fmt.Errorf("getting internal auth password from file: %w", err))
 	}
 	a := backendaction.New(s.config.manageBackendActionURL(), pw, backendaction.ActionRoute)
 	return setpassword.SetPassword(ctx, in, a)
 }
 
 func (s *srv) Get(ctx context.Context, in *proto.GetRequest) (*proto.GetResponse, error) {
-	ds := datastorereader.New(s.config.datastoreReaderURL())
+	ds := datastorereader.New(s.config.DatastoreReaderURL())
 	return get.Get(ctx, in, ds)
 }
 
 func (s *srv) Action(ctx context.Context, in *proto.ActionRequest) (*proto.ActionResponse, error) {
-	pw, err := shared.AuthSecret(s.config.InternalAuthPasswordFile, s.config.OpenSlidesDevelopment)
+	pw, err := s.internalPassword()
 	if err != nil {
-		return nil, fmt.Errorf("getting internal auth password from file: %w", err)
+		return nil, fehler.WithCode(codes.Internal, fmt.Errorf("getting internal auth password from file: %w", err))
 	}
 	a := backendaction.New(s.config.manageBackendActionURL(), pw, backendaction.ActionRoute)
-	return action.Action(ctx, in, a)
+	return action.Action(ctx, in, a, s.actionPolicy)
 }
 
 func (s *srv) Version(ctx context.Context, in *proto.VersionRequest) (*proto.VersionResponse, error) {
@@ -160,18 +373,114 @@ func (s *srv) Health(ctx context.Context, in *proto.HealthRequest) (*proto.Healt
 }
 
 func logUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	info.Server.(*srv).logger.Debugf("Incomming unary RPC for %s: %v", info.FullMethod, req)
+	s, ok := info.Server.(*srv)
+	if !ok {
+		// Standard services like the health service are not logged.
+		return handler(ctx, req)
+	}
+	id := requestID(ctx)
+	ctx = shared.WithRequestID(ctx, id)
+	// The gateway calls the handler without gRPC stream, so an error is
+	// expected there.
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+
+	logger := s.logger.With("request_id", id).With("rpc", info.FullMethod)
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		logger = logger.With("trace_id", traceID)
+	}
+	ctx = shared.WithLogger(ctx, logger)
+
+	if encReq, err := json.Marshal(s.redactor.request(req)); err == nil {
+		logger.Debugf("Incomming unary RPC for %s: %s", info.FullMethod, encReq)
+	}
+	start := time.Now()
 	resp, err := handler(ctx, req)
+	rpcDuration.Observe(time.Since(start).Seconds(), info.FullMethod)
 	if err != nil {
-		return nil, fmt.Errorf("calling handler: %w", err)
+		err = statusError(fmt.Errorf("calling handler: %w", err))
+		switch code := status.Code(err); code {
+		case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+			codes.Unauthenticated, codes.FailedPrecondition, codes.Canceled:
+			// The client did something wrong, the server works as expected.
+			logger.Warningf("Call failed with status %s: %v", code, err)
+		default:
+			logger.Errorf("Call failed with status %s: %v", code, err)
+		}
+		rpcRequests.Inc(info.FullMethod, status.Code(err).String())
+		return nil, err
 	}
+	rpcRequests.Inc(info.FullMethod, codes.OK.String())
 	return resp, nil
 }
 
+// newRequestID returns a random id to find all log lines of a request.
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusError converts the given error into a gRPC status error. If there is an
+// error with a gRPC status (like a backend error) in the chain, its code and
+// details are used together with the message of the whole chain. Else the code
+// is derived from the kind of the error.
+func statusError(err error) error {
+	var se interface {
+		GRPCStatus() *status.Status
+	}
+	if errors.As(err, &se) {
+		s := se.GRPCStatus().Proto()
+		s.Message = err.Error()
+		return status.ErrorProto(s)
+	}
+	return status.Error(errorCode(err), err.Error())
+}
+
+// errorCode returns the gRPC status code for errors without attached status.
+func errorCode(err error) codes.Code {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded
+	}
+	if errors.Is(err, context.Canceled) {
+		return codes.Canceled
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		// Connection failures to the backend, the datastore or the client
+		// service.
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
 func authUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	if err := info.Server.(*srv).serverAuth(ctx); err != nil {
+	s, ok := info.Server.(*srv)
+	if !ok {
+		// Standard services like the health service need no authentication.
+		return handler(ctx, req)
+	}
+	if err := s.checkAuthLimit(ctx); err != nil {
 		return nil, fmt.Errorf("server authentication: %w", err)
 	}
+	t, err := s.serverAuth(ctx)
+	s.authResult(ctx, err)
+	if err != nil {
+		return nil, fehler.WithCode(codes.Unauthenticated, fmt.Errorf("server authentication: %w", err))
+	}
+	if err := t.allowRPC(info.FullMethod, req); err != nil {
+		return nil, fehler.WithCode(codes.PermissionDenied, fmt.Errorf("checking permissions: %w", err))
+	}
+	logger := shared.LoggerFromContext(ctx).With("token", t.Name)
+	ctx = shared.WithLogger(ctx, logger)
+	if path.Base(info.FullMethod) == "Health" {
+		// The healthcheck is called regularly and would flood the log.
+		logger.Debugf("Call of %s with token %q", info.FullMethod, t.Name)
+	} else {
+		logger.Infof("Call of %s with token %q", info.FullMethod, t.Name)
+	}
+	callInfoFromContext(ctx).token = t.Name
 	resp, err := handler(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("calling handler: %w", err)
@@ -179,25 +488,27 @@ func authUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.Unary
 	return resp, nil
 }
 
-func (s *srv) serverAuth(ctx context.Context) error {
+// serverAuth checks the authorization header and returns the matching token.
+func (s *srv) serverAuth(ctx context.Context) (*token, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return fmt.Errorf("getting metadata from context: failed")
+		return nil, fmt.Errorf("getting metadata from context: failed")
 	}
 	a := md.Get("authorization")
 	if len(a) == 0 {
-		return fmt.Errorf("no authorization header found")
+		return nil, fmt.Errorf("no authorization header found")
 	}
 	password, err := base64.StdEncoding.DecodeString(a[0])
 	if err != nil {
-		return fmt.Errorf("decoding password (base64): %w", err)
+		return nil, fmt.Errorf("decoding password (base64): %w", err)
 	}
 
-	if subtle.ConstantTimeCompare(password, s.pw) != 1 {
-		return fmt.Errorf("password does not match")
+	t := findToken(s.tokens, password, s.secrets)
+	if t == nil {
+		return nil, fmt.Errorf("password does not match")
 	}
 
-	return nil
+	return t, nil
 }
 
 // Config holds config data for the server.
@@ -206,21 +517,105 @@ type Config struct {
 	// variables. The first value is the name of the environment variable. After
 	// a comma the default value can be given. If no default value is given, then
 	// an empty string is used. The type of a env field has to be string.
-	Port                     string `env:"MANAGE_PORT,9008"`
+	Port string `env:"MANAGE_PORT,9008"`
+
+	// The secrets are files or URIs like env://NAME, keystore:///path#name or
+	// https://vault:8200/v1/secret/data/manage#password, see secrets.Open.
 	ManageAuthPasswordFile   string `env:"MANAGE_AUTH_PASSWORD_FILE,/run/secrets/manage_auth_password"`
 	InternalAuthPasswordFile string `env:"INTERNAL_AUTH_PASSWORD_FILE,/run/secrets/internal_auth_password"`
 	SuperadminPasswordFile   string `env:"SUPERADMIN_PASSWORD_FILE,/run/secrets/superadmin"`
 
+	// ManageAuthTokensFile is an optional YAML file with further named tokens
+	// that may only call some RPCs and actions. The password of
+	// ManageAuthPasswordFile may call everything.
+	ManageAuthTokensFile string `env:"MANAGE_AUTH_TOKENS_FILE"`
+
+	// After AuthMaxFailures failed authentications a peer (IP address or user
+	// id on a Unix domain socket) is locked out for AuthLockout. Every further
+	// failure doubles the lockout up to AuthMaxLockout. A value of 0 for
+	// AuthMaxFailures disables the lockout.
+	AuthMaxFailures string `env:"MANAGE_AUTH_MAX_FAILURES,5"`
+	AuthLockout     string `env:"MANAGE_AUTH_LOCKOUT,30s"`
+	AuthMaxLockout  string `env:"MANAGE_AUTH_MAX_LOCKOUT,1h"`
+
+	// RateLimits limits the calls per procedure for all clients together,
+	// e. g. "SetPassword=10/m,CreateUser=100/h".
+	RateLimits string `env:"MANAGE_RATE_LIMITS"`
+
 	ManageActionProtocol string `env:"ACTION_PROTOCOL,http"`
 	ManageActionHost     string `env:"ACTION_HOST,backendManage"`
 	ManageActionPort     string `env:"ACTION_PORT,9002"`
 
+	// AuditLog is "stdout" or the path of a file. If given, every call is
+	// written as JSON line to this destination. The values of the comma
+	// separated fields in AuditRedactFields are redacted in the audit log and
+	// in the debug log, also inside of action payloads.
+	AuditLog          string `env:"MANAGE_AUDIT_LOG"`
+	AuditRedactFields string `env:"MANAGE_AUDIT_REDACT_FIELDS,password,default_password,new_password"`
+
+	// Comma separated patterns of actions that may be called via the Action
+	// procedure. Deny patterns take precedence, e. g. allow "*.update" and
+	// deny "organization.*delete*".
+	ActionAllow string `env:"MANAGE_ACTION_ALLOW,*"`
+	ActionDeny  string `env:"MANAGE_ACTION_DENY"`
+
 	DatastoreReaderProtocol string `env:"DATASTORE_READER_PROTOCOL,http"`
 	DatastoreReaderHost     string `env:"DATASTORE_READER_HOST,datastore-reader"`
 	DatastoreReaderPort     string `env:"DATASTORE_READER_PORT,9010"`
 
+	// TLS is only used if a certificate and a key file are given. If a client
+	// CA file is given, clients have to present a certificate signed by this
+	// CA. All files are reloaded if they change.
+	TLSCertFile     string `env:"MANAGE_TLS_CERT_FILE"`
+	TLSKeyFile      string `env:"MANAGE_TLS_KEY_FILE"`
+	TLSClientCAFile string `env:"MANAGE_TLS_CLIENT_CA_FILE"`
+
+	// HealthcheckClientCertFile and HealthcheckClientKeyFile are the client
+	// certificate of the healthcheck binary. They are required if a client
+	// CA file is given.
+	HealthcheckClientCertFile string `env:"MANAGE_HEALTHCHECK_CLIENT_CERT_FILE"`
+	HealthcheckClientKeyFile  string `env:"MANAGE_HEALTHCHECK_CLIENT_KEY_FILE"`
+
 	OpenSlidesDevelopment string `env:"OPENSLIDES_DEVELOPMENT,0"`
 	OpenSlidesLoglevel    string `env:"OPENSLIDES_LOGLEVEL,info"`
+
+	// MetricsPort is the port of the HTTP listener for Prometheus metrics
+	// under /metrics. It is disabled if empty.
+	MetricsPort string `env:"MANAGE_METRICS_PORT"`
+
+	// Listen is a comma separated list of addresses like :9008 or
+	// unix:///run/manage.sock. If it is empty, the server listens on the TCP
+	// port given by Port. Unix domain sockets get the mode SocketMode.
+	Listen     string `env:"MANAGE_LISTEN"`
+	SocketMode string `env:"MANAGE_SOCKET_MODE,0660"`
+
+	// MaxDeadlines limits the time of calls per procedure, e. g.
+	// "default=5m,Migrations=1h". Shorter deadlines of clients are kept.
+	MaxDeadlines string `env:"MANAGE_MAX_DEADLINES,default=5m,Migrations=1h,InitialData=1h"`
+
+	// Secret files are cached and reloaded every SecretPollInterval (0
+	// disables polling) and on SIGHUP. If the manage password or a token file
+	// changes, the old value is accepted for SecretGracePeriod.
+	SecretPollInterval string `env:"MANAGE_SECRET_POLL_INTERVAL,10s"`
+	SecretGracePeriod  string `env:"MANAGE_SECRET_GRACE_PERIOD,5m"`
+
+	// GatewayPort is the port of the HTTP/JSON gateway. It is disabled if
+	// empty. The gateway uses the same TLS configuration as the gRPC server.
+	GatewayPort string `env:"MANAGE_GATEWAY_PORT"`
+
+	// HealthCheckInterval is the interval in which the backend is checked to
+	// set the status of the standard gRPC health service.
+	HealthCheckInterval string `env:"MANAGE_HEALTH_CHECK_INTERVAL,10s"`
+
+	// LogFormat is one of text, json and logfmt.
+	LogFormat string `env:"MANAGE_LOG_FORMAT,text"`
+
+	// TracingExporter is empty (no tracing), "otlp" or "file". Spans are sent
+	// via OTLP/HTTP to TracingOTLPEndpoint or written as JSON lines to
+	// TracingFile.
+	TracingExporter     string `env:"MANAGE_TRACING_EXPORTER"`
+	TracingOTLPEndpoint string `env:"MANAGE_TRACING_OTLP_ENDPOINT,http://localhost:4318"`
+	TracingFile         string `env:"MANAGE_TRACING_FILE"`
 }
 
 // ConfigFromEnv creates a Config object where the values are populated from the
@@ -252,6 +647,18 @@ func ConfigFromEnv(loockup func(string) (string, bool)) *Config {
 	return &c
 }
 
+// splitList splits a comma separated list from the environment and removes
+// empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
 // manageBackendActionURL returns an URL object to the backend action service
 // with action route.
 func (c *Config) manageBackendActionURL() *url.URL {
@@ -274,9 +681,9 @@ func (c *Config) manageBackendMigrationsURL() *url.URL {
 	return &u
 }
 
-// manageBackendHealthURL returns an URL object to the backend action service
+// ManageBackendHealthURL returns an URL object to the backend action service
 // with health route.
-func (c *Config) manageBackendHealthURL() *url.URL {
+func (c *Config) ManageBackendHealthURL() *url.URL {
 	u := url.URL{
 		Scheme: c.ManageActionProtocol,
 		Host:   c.ManageActionHost + ":" + c.ManageActionPort,
@@ -285,8 +692,8 @@ func (c *Config) manageBackendHealthURL() *url.URL {
 	return &u
 }
 
-// datastoreReaderURL returns an URL object to the datastore reader service.
-func (c *Config) datastoreReaderURL() *url.URL {
+// DatastoreReaderURL returns an URL object to the datastore reader service.
+func (c *Config) DatastoreReaderURL() *url.URL {
 	u := url.URL{
 		Scheme: c.DatastoreReaderProtocol,
 		Host:   c.DatastoreReaderHost + ":" + c.DatastoreReaderPort,
@@ -305,6 +712,23 @@ func (c *Config) clientVersionURL() *url.URL {
 	return &u
 }
 
+// reloadOnSIGHUP reloads all secrets when the process receives SIGHUP until
+// the context is done.
+func reloadOnSIGHUP(ctx context.Context, p *secrets.Provider, logger shared.Logger) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, unix.SIGHUP)
+	defer signal.Stop(sigs)
+	for {
+		select {
+		case <-sigs:
+			logger.Infof("Received SIGHUP, reloading secrets")
+			p.Reload()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // waitForShutdown blocks until the service exits.
 //
 // It listens on SIGINT and SIGTERM. If the signal is received for a second
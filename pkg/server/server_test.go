@@ -1,9 +1,905 @@
 package server_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/server"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
 )
 
 func TestRunServer(t *testing.T) {
 	t.Skip("test is missing here")
 }
+
+// writeCert creates a self-signed certificate with the given common name and
+// writes it together with its key to the given files.
+func writeCert(t testing.TB, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	encKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("writing certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: encKey}), 0600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+}
+
+func commonName(t testing.TB, c *tls.Config) string {
+	t.Helper()
+	cc, err := c.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("getting TLS config for client: %v", err)
+	}
+	cert, err := x509.ParseCertificate(cc.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	return cert.Subject.CommonName
+}
+
+func TestTLSConfig(t *testing.T) {
+	logger, err := shared.NewLogger("info", shared.LogFormatText)
+	if err != nil {
+		t.Fatalf("creating logger: %v", err)
+	}
+
+	t.Run("without certificate", func(t *testing.T) {
+		c, err := server.TLSConfig(server.ConfigFromEnv(func(string) (string, bool) { return "", false }), logger)
+		if err != nil {
+			t.Fatalf("creating TLS config: %v", err)
+		}
+		if c != nil {
+			t.Fatalf("TLS config should be nil without certificate")
+		}
+	})
+
+	t.Run("missing key file", func(t *testing.T) {
+		cfg := &server.Config{TLSCertFile: "cert.pem"}
+		if _, err := server.TLSConfig(cfg, logger); err == nil {
+			t.Fatalf("creating TLS config without key file should fail but it didn't")
+		}
+	})
+
+	t.Run("reload on change", func(t *testing.T) {
+		dir := t.TempDir()
+		cfg := &server.Config{
+			TLSCertFile: path.Join(dir, "cert.pem"),
+			TLSKeyFile:  path.Join(dir, "key.pem"),
+		}
+		writeCert(t, cfg.TLSCertFile, cfg.TLSKeyFile, "first")
+
+		c, err := server.TLSConfig(cfg, logger)
+		if err != nil {
+			t.Fatalf("creating TLS config: %v", err)
+		}
+		if got := commonName(t, c); got != "first" {
+			t.Fatalf("wrong certificate, expected %q, got %q", "first", got)
+		}
+
+		writeCert(t, cfg.TLSCertFile, cfg.TLSKeyFile, "second")
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(cfg.TLSCertFile, later, later)
+		time.Sleep(1100 * time.Millisecond) // Files are checked at most once per second.
+
+		if got := commonName(t, c); got != "second" {
+			t.Fatalf("certificate was not reloaded, expected %q, got %q", "second", got)
+		}
+	})
+}
+
+// startServer runs the manage server with the given config on a free port and
+// returns its address.
+func freePort(t testing.TB) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("finding free port: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	lis.Close()
+	return port
+}
+
+func startServer(t testing.TB, cfg *server.Config) string {
+	t.Helper()
+	port := freePort(t)
+	cfg.Port = port
+	go server.Run(cfg)
+	return "localhost:" + port
+}
+
+// writeFile writes the content to a new file in the given directory and
+// returns its path.
+func writeFile(t testing.TB, dir, name, content string) string {
+	t.Helper()
+	p := path.Join(dir, name)
+	if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatalf("writing file %q: %v", name, err)
+	}
+	return p
+}
+
+func TestTokens(t *testing.T) {
+	dir := t.TempDir()
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "admin-password")
+	cfg.ManageAuthTokensFile = writeFile(t, dir, "tokens.yml", `---
+tokens:
+  - name: readonly
+    token: readonly-token
+    rpcs: [Health, Get]
+  - name: helpdesk
+    token_file: `+writeFile(t, dir, "helpdesk_token", "helpdesk-token\n")+`
+    rpcs: [Action]
+    actions: [user.update, user.set_password*]
+`)
+	addr := startServer(t, cfg)
+
+	for _, tt := range []struct {
+		name     string
+		password string
+		call     func(context.Context, proto.ManageClient) error
+		code     codes.Code
+	}{
+		{
+			name:     "admin may call everything",
+			password: "admin-password",
+			call: func(ctx context.Context, cl proto.ManageClient) error {
+				_, err := cl.Health(ctx, &proto.HealthRequest{})
+				return err
+			},
+			code: codes.OK,
+		},
+		{
+			name:     "readonly token with allowed RPC",
+			password: "readonly-token",
+			call: func(ctx context.Context, cl proto.ManageClient) error {
+				_, err := cl.Health(ctx, &proto.HealthRequest{})
+				return err
+			},
+			code: codes.OK,
+		},
+		{
+			name:     "readonly token with forbidden RPC",
+			password: "readonly-token",
+			call: func(ctx context.Context, cl proto.ManageClient) error {
+				_, err := cl.SetPassword(ctx, &proto.SetPasswordRequest{UserID: 1, Password: "foo"})
+				return err
+			},
+			code: codes.PermissionDenied,
+		},
+		{
+			name:     "helpdesk token with forbidden action",
+			password: "helpdesk-token",
+			call: func(ctx context.Context, cl proto.ManageClient) error {
+				_, err := cl.Action(ctx, &proto.ActionRequest{Action: "user.delete", Payload: []byte("[]")})
+				return err
+			},
+			code: codes.PermissionDenied,
+		},
+		{
+			name:     "unknown token",
+			password: "unknown-token",
+			call: func(ctx context.Context, cl proto.ManageClient) error {
+				_, err := cl.Health(ctx, &proto.HealthRequest{})
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			cl, close, err := connection.Dial(ctx, addr, writeFile(t, t.TempDir(), "password", tt.password), nil)
+			if err != nil {
+				t.Fatalf("connecting to server: %v", err)
+			}
+			defer close()
+
+			err = tt.call(ctx, cl)
+			if got := status.Code(err); got != tt.code {
+				t.Fatalf("wrong status code, expected %s, got %s (%v)", tt.code, got, err)
+			}
+		})
+	}
+
+	t.Run("invalid token file", func(t *testing.T) {
+		cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+		cfg.Port = "0"
+		cfg.ManageAuthTokensFile = writeFile(t, t.TempDir(), "tokens.yml", "tokens: [{name: foo, token: bar, rpcs: [Unknown]}]")
+		cfg.ManageAuthPasswordFile = writeFile(t, t.TempDir(), "manage_auth_password", "admin-password")
+		if err := server.Run(cfg); err == nil {
+			t.Fatalf("running server with invalid token file should fail but it didn't")
+		}
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "admin-password")
+	cfg.InternalAuthPasswordFile = writeFile(t, dir, "internal_auth_password", "internal-password")
+	cfg.ManageActionHost = "localhost"
+	cfg.ManageActionPort = "1" // Nothing listens here, so all backend calls fail.
+	cfg.AuditLog = path.Join(dir, "audit.log")
+	addr := startServer(t, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cl, close, err := connection.Dial(ctx, addr, cfg.ManageAuthPasswordFile, nil)
+	if err != nil {
+		t.Fatalf("connecting to server: %v", err)
+	}
+	defer close()
+
+	// The backend is retried until the deadline, so use short timeouts.
+	callCtx, callCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer callCancel()
+	cl.SetPassword(callCtx, &proto.SetPasswordRequest{UserID: 7, Password: "secret-password"})
+	callCtx, callCancel = context.WithTimeout(ctx, 500*time.Millisecond)
+	defer callCancel()
+	cl.Action(callCtx, &proto.ActionRequest{Action: "user.update", Payload: []byte(`[{"id": 8, "default_password": "secret-password"}]`)})
+
+	// The server writes the entries after the deadline of the client, so
+	// wait for them.
+	var content []byte
+	for i := 0; i < 20; i++ {
+		content, err = os.ReadFile(cfg.AuditLog)
+		if err != nil {
+			t.Fatalf("reading audit log: %v", err)
+		}
+		if bytes.Count(content, []byte("\n")) >= 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if bytes.Contains(content, []byte("secret-password")) {
+		t.Fatalf("audit log contains password:\n%s", content)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("wrong number of audit entries, expected 2, got %d:\n%s", len(lines), content)
+	}
+	var entry struct {
+		Token   string                 `json:"token"`
+		RPC     string                 `json:"rpc"`
+		Request map[string]interface{} `json:"request"`
+		Result  string                 `json:"result"`
+		Peer    string                 `json:"peer"`
+	}
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatalf("decoding audit entry: %v", err)
+	}
+	if entry.Token != "admin" || entry.RPC != "/Manage/SetPassword" || entry.Peer == "" {
+		t.Fatalf("wrong audit entry: %s", lines[0])
+	}
+	if entry.Request["userID"] != 7.0 || entry.Request["password"] != "[REDACTED]" {
+		t.Fatalf("wrong request in audit entry: %s", lines[0])
+	}
+	if entry.Result == "OK" {
+		t.Fatalf("failing call was logged as successful: %s", lines[0])
+	}
+}
+
+func TestStandardHealth(t *testing.T) {
+	var backendUp atomic.Bool
+	backendUp.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !backendUp.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status": "running"}`))
+	}))
+	defer backend.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+
+	dir := t.TempDir()
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "admin-password")
+	cfg.InternalAuthPasswordFile = writeFile(t, dir, "internal_auth_password", "internal-password")
+	cfg.ManageActionHost = host
+	cfg.ManageActionPort = port
+	cfg.HealthCheckInterval = "50ms"
+	addr := startServer(t, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("connecting to server: %v", err)
+	}
+	defer conn.Close()
+	cl := healthpb.NewHealthClient(conn)
+
+	waitForStatus := func(expected healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		var got healthpb.HealthCheckResponse_ServingStatus
+		for i := 0; i < 50; i++ {
+			// No authorization is sent.
+			resp, err := cl.Check(ctx, &healthpb.HealthCheckRequest{Service: "Manage"})
+			if err != nil {
+				t.Fatalf("calling health check: %v", err)
+			}
+			got = resp.Status
+			if got == expected {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("wrong serving status, expected %s, got %s", expected, got)
+	}
+
+	waitForStatus(healthpb.HealthCheckResponse_SERVING)
+	backendUp.Store(false)
+	waitForStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	t.Run("reflection", func(t *testing.T) {
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		if err != nil {
+			t.Fatalf("opening reflection stream: %v", err)
+		}
+		if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		}); err != nil {
+			t.Fatalf("sending reflection request: %v", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("receiving reflection response: %v", err)
+		}
+		var services []string
+		for _, s := range resp.GetListServicesResponse().GetService() {
+			services = append(services, s.Name)
+		}
+		if !strings.Contains(strings.Join(services, " "), "Manage") {
+			t.Fatalf("manage service is not listed, got %v", services)
+		}
+	})
+}
+
+func TestGateway(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": true, "message": "", "results": [[{"id": 7}]]}`))
+	}))
+	defer backend.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+
+	dir := t.TempDir()
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "admin-password")
+	cfg.InternalAuthPasswordFile = writeFile(t, dir, "internal_auth_password", "internal-password")
+	cfg.ManageActionHost = host
+	cfg.ManageActionPort = port
+	cfg.GatewayPort = freePort(t)
+	startServer(t, cfg)
+	gatewayURL := "http://localhost:" + cfg.GatewayPort
+
+	// Wait for the gateway.
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get(gatewayURL + "/v1/health")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{
+			name:       "health",
+			method:     "GET",
+			path:       "/v1/health",
+			token:      "admin-password",
+			statusCode: http.StatusOK,
+			expected:   `{"ok":true,"result":{"healthy":true}}`,
+		},
+		{
+			name:       "action",
+			method:     "POST",
+			path:       "/v1/actions/user.update",
+			token:      "admin-password",
+			body:       `[{"id": 7, "first_name": "foo"}]`,
+			statusCode: http.StatusOK,
+			expected:   `{"ok":true,"result":[{"id":7}]}`,
+		},
+		{
+			name:       "create user",
+			method:     "POST",
+			path:       "/v1/users",
+			token:      "admin-password",
+			body:       `{"username": "foo", "default_password": "bar"}`,
+			statusCode: http.StatusOK,
+			expected:   `{"ok":true,"result":{"user_id":7}}`,
+		},
+		{
+			name:       "wrong token",
+			method:     "GET",
+			path:       "/v1/health",
+			token:      "wrong",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong token with body",
+			method:     "POST",
+			path:       "/v1/initial-data",
+			token:      "wrong",
+			body:       `{}`,
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "body too large",
+			method:     "POST",
+			path:       "/v1/actions/user.update",
+			token:      "admin-password",
+			body:       `[{"id": 7, "first_name": "` + strings.Repeat("a", 1<<20) + `"}]`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid user id",
+			method:     "PUT",
+			path:       "/v1/users/foo/password",
+			token:      "admin-password",
+			body:       `{"password": "bar"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown path",
+			method:     "GET",
+			path:       "/v1/unknown",
+			token:      "admin-password",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "wrong method",
+			method:     "GET",
+			path:       "/v1/actions/user.update",
+			token:      "admin-password",
+			statusCode: http.StatusMethodNotAllowed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, gatewayURL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("creating request: %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("sending request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body := new(bytes.Buffer)
+			body.ReadFrom(resp.Body)
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("wrong status code, expected %d, got %d: %s", tt.statusCode, resp.StatusCode, body)
+			}
+			if tt.expected == "" {
+				var doc struct {
+					OK bool `json:"ok"`
+				}
+				if err := json.Unmarshal(body.Bytes(), &doc); err != nil || doc.OK {
+					t.Fatalf("expected error document, got %s", body)
+				}
+				return
+			}
+			compact := new(bytes.Buffer)
+			if err := json.Compact(compact, body.Bytes()); err != nil {
+				t.Fatalf("invalid JSON response %s: %v", body, err)
+			}
+			if compact.String() != tt.expected {
+				t.Fatalf("wrong response, expected %s, got %s", tt.expected, compact)
+			}
+		})
+	}
+}
+
+func TestUnixPeerName(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on Linux")
+	}
+	socket := path.Join(t.TempDir(), "manage.sock")
+	lis, err := server.Listen("unix://"+socket, "0600")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer lis.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	client, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("dialing socket: %v", err)
+	}
+	defer client.Close()
+	conn, ok := <-accepted
+	if !ok {
+		t.Fatalf("accepting connection failed")
+	}
+	defer conn.Close()
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: conn.RemoteAddr()})
+	expected := fmt.Sprintf("unix:uid=%d", os.Getuid())
+	if got := server.PeerName(ctx); got != expected {
+		t.Fatalf("wrong peer name, expected %q, got %q", expected, got)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	socket := path.Join(dir, "manage.sock")
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "admin-password")
+	cfg.Listen = "unix://" + socket
+	cfg.SocketMode = "0600"
+	go server.Run(cfg)
+
+	if got := cfg.LocalAddress(); got != "unix://"+socket {
+		t.Fatalf("wrong local address, got %q", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cl, close, err := connection.Dial(ctx, "unix://"+socket, cfg.ManageAuthPasswordFile, nil)
+	if err != nil {
+		t.Fatalf("connecting to server: %v", err)
+	}
+	defer close()
+
+	resp, err := cl.Health(ctx, &proto.HealthRequest{})
+	if err != nil {
+		t.Fatalf("calling health: %v", err)
+	}
+	if !resp.Healthy {
+		t.Fatalf("server is not healthy")
+	}
+
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("checking socket: %v", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("wrong mode of socket, expected 0600, got %o", fi.Mode().Perm())
+	}
+}
+
+func TestLocalAddress(t *testing.T) {
+	for _, tt := range []struct {
+		listen   string
+		expected string
+	}{
+		{"", "localhost:9008"},
+		{":9000", "localhost:9000"},
+		{"0.0.0.0:9000,unix:///run/manage.sock", "localhost:9000"},
+		{"tcp://127.0.0.1:9000", "127.0.0.1:9000"},
+		{"unix:///run/manage.sock, :9008", "unix:///run/manage.sock"},
+	} {
+		cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+		cfg.Listen = tt.listen
+		if got := cfg.LocalAddress(); got != tt.expected {
+			t.Errorf("listen %q: wrong local address, expected %q, got %q", tt.listen, tt.expected, got)
+		}
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/Manage/Action"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		var m map[string]int
+		m["boom"] = 1 // Panics.
+		return nil, nil
+	}
+
+	resp, err := server.RecoveryUnaryInterceptor(context.Background(), nil, info, handler)
+	if resp != nil {
+		t.Fatalf("expected no response, got %v", resp)
+	}
+	var se interface {
+		GRPCStatus() *status.Status
+	}
+	if !errors.As(err, &se) || se.GRPCStatus().Code() != codes.Internal {
+		t.Fatalf("expected error with status code Internal, got %v", err)
+	}
+}
+
+func TestRecoveryAudit(t *testing.T) {
+	dir := t.TempDir()
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "admin-password")
+	cfg.InternalAuthPasswordFile = writeFile(t, dir, "internal_auth_password", "internal-password")
+
+	md := metadata.Pairs("authorization", base64.StdEncoding.EncodeToString([]byte("admin-password")))
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	}
+
+	audit := new(bytes.Buffer)
+	_, err := server.Intercept(ctx, cfg, audit, "/Manage/SetPassword", &proto.SetPasswordRequest{UserID: 7}, handler)
+	var se interface {
+		GRPCStatus() *status.Status
+	}
+	if !errors.As(err, &se) || se.GRPCStatus().Code() != codes.Internal {
+		t.Fatalf("expected error with status code Internal, got %v", err)
+	}
+
+	var entry struct {
+		Token  string `json:"token"`
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(audit.Bytes(), &entry); err != nil {
+		t.Fatalf("decoding audit entry %q: %v", audit, err)
+	}
+	if entry.Token != "admin" || entry.Result != "Internal" {
+		t.Fatalf("wrong audit entry: %s", audit)
+	}
+}
+
+func TestParseDeadlines(t *testing.T) {
+	d, err := server.ParseDeadlines("default=5m, Migrations=1h")
+	if err != nil {
+		t.Fatalf("parsing deadlines: %v", err)
+	}
+	if d["default"] != 5*time.Minute || d["Migrations"] != time.Hour {
+		t.Fatalf("wrong deadlines, got %v", d)
+	}
+
+	for _, invalid := range []string{"Unknown=1m", "Action", "Action=soon"} {
+		if _, err := server.ParseDeadlines(invalid); err == nil {
+			t.Errorf("parsing %q should fail but it didn't", invalid)
+		}
+	}
+}
+
+func TestRequestIDAndDeadline(t *testing.T) {
+	requestIDs := make(chan string, 10)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestIDs <- r.Header.Get("X-Request-ID")
+		if r.URL.Path == "/internal/handle_request" {
+			// Slow action.
+			time.Sleep(time.Second)
+		}
+		w.Write([]byte(`{"success": true, "message": "", "results": [[{"id": 7}]]}`))
+	}))
+	defer backend.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+
+	dir := t.TempDir()
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "admin-password")
+	cfg.InternalAuthPasswordFile = writeFile(t, dir, "internal_auth_password", "internal-password")
+	cfg.ManageActionHost = host
+	cfg.ManageActionPort = port
+	cfg.HealthCheckInterval = "1h"
+	cfg.MaxDeadlines = "default=5s,Action=100ms"
+	addr := startServer(t, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cl, close, err := connection.Dial(ctx, addr, cfg.ManageAuthPasswordFile, nil)
+	if err != nil {
+		t.Fatalf("connecting to server: %v", err)
+	}
+	defer close()
+	<-requestIDs // Request of the health watcher.
+
+	t.Run("request id", func(t *testing.T) {
+		var header metadata.MD
+		callCtx := metadata.AppendToOutgoingContext(ctx, "x-request-id", "my-request-1")
+		if _, err := cl.CheckServer(callCtx, &proto.CheckServerRequest{}, grpc.Header(&header)); err != nil {
+			t.Fatalf("calling check server: %v", err)
+		}
+		if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "my-request-1" {
+			t.Fatalf("wrong request id in response header, got %v", got)
+		}
+		if got := <-requestIDs; got != "my-request-1" {
+			t.Fatalf("wrong request id sent to backend, got %q", got)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		start := time.Now()
+		_, err := cl.Action(ctx, &proto.ActionRequest{Action: "user.update", Payload: []byte(`[{"id": 7}]`)})
+		if got := status.Code(err); got != codes.DeadlineExceeded {
+			t.Fatalf("wrong status code, expected %s, got %s (%v)", codes.DeadlineExceeded, got, err)
+		}
+		if d := time.Since(start); d > 900*time.Millisecond {
+			t.Fatalf("call took %s, the server deadline was not used", d)
+		}
+	})
+}
+
+func TestAuthLockout(t *testing.T) {
+	dir := t.TempDir()
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "admin-password")
+	cfg.AuthMaxFailures = "2"
+	cfg.AuthLockout = "1h"
+	addr := startServer(t, cfg)
+
+	call := func(password string) codes.Code {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		cl, close, err := connection.Dial(ctx, addr, writeFile(t, t.TempDir(), "password", password), nil)
+		if err != nil {
+			t.Fatalf("connecting to server: %v", err)
+		}
+		defer close()
+		_, err = cl.Health(ctx, &proto.HealthRequest{})
+		return status.Code(err)
+	}
+
+	if got := call("admin-password"); got != codes.OK {
+		t.Fatalf("first call with correct password: expected %s, got %s", codes.OK, got)
+	}
+	for i := 0; i < 2; i++ {
+		if got := call("wrong"); got != codes.Unauthenticated {
+			t.Fatalf("call with wrong password: expected %s, got %s", codes.Unauthenticated, got)
+		}
+	}
+	if got := call("admin-password"); got != codes.ResourceExhausted {
+		t.Fatalf("call after lockout: expected %s, got %s", codes.ResourceExhausted, got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "admin-password")
+	cfg.RateLimits = "Health=2/h"
+	addr := startServer(t, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cl, close, err := connection.Dial(ctx, addr, cfg.ManageAuthPasswordFile, nil)
+	if err != nil {
+		t.Fatalf("connecting to server: %v", err)
+	}
+	defer close()
+
+	for i, expected := range []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted} {
+		_, err := cl.Health(ctx, &proto.HealthRequest{})
+		if got := status.Code(err); got != expected {
+			t.Fatalf("call %d: expected %s, got %s (%v)", i+1, expected, got, err)
+		}
+	}
+
+	t.Run("invalid limit", func(t *testing.T) {
+		cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+		cfg.Port = "0"
+		cfg.ManageAuthPasswordFile = writeFile(t, t.TempDir(), "manage_auth_password", "admin-password")
+		cfg.RateLimits = "Health=2/d"
+		if err := server.Run(cfg); err == nil {
+			t.Fatalf("running server with invalid rate limit should fail but it didn't")
+		}
+	})
+}
+
+func TestSecretRotation(t *testing.T) {
+	dir := t.TempDir()
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = writeFile(t, dir, "manage_auth_password", "old-password")
+	cfg.SecretPollInterval = "20ms"
+	cfg.SecretGracePeriod = "1h"
+	addr := startServer(t, cfg)
+
+	call := func(password string) codes.Code {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		cl, close, err := connection.Dial(ctx, addr, writeFile(t, t.TempDir(), "password", password), nil)
+		if err != nil {
+			t.Fatalf("connecting to server: %v", err)
+		}
+		defer close()
+		_, err = cl.Health(ctx, &proto.HealthRequest{})
+		return status.Code(err)
+	}
+
+	if got := call("old-password"); got != codes.OK {
+		t.Fatalf("call with old password before rotation: expected %s, got %s", codes.OK, got)
+	}
+
+	writeFile(t, dir, "manage_auth_password", "new-password")
+	var got codes.Code
+	for i := 0; i < 50; i++ {
+		if got = call("new-password"); got == codes.OK {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got != codes.OK {
+		t.Fatalf("call with new password after rotation: expected %s, got %s", codes.OK, got)
+	}
+	if got := call("old-password"); got != codes.OK {
+		t.Fatalf("call with old password during grace period: expected %s, got %s", codes.OK, got)
+	}
+}
+
+func TestSecretURI(t *testing.T) {
+	t.Setenv("TEST_MANAGE_PASSWORD", "env-password")
+	cfg := server.ConfigFromEnv(func(string) (string, bool) { return "", false })
+	cfg.ManageAuthPasswordFile = "env://TEST_MANAGE_PASSWORD"
+	addr := startServer(t, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cl, close, err := connection.Dial(ctx, addr, "env://TEST_MANAGE_PASSWORD", nil)
+	if err != nil {
+		t.Fatalf("connecting to server: %v", err)
+	}
+	defer close()
+	if _, err := cl.Health(ctx, &proto.HealthRequest{}); err != nil {
+		t.Fatalf("calling health with password from environment: %v", err)
+	}
+}
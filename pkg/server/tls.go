@@ -0,0 +1,172 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+)
+
+// tlsCheckInterval is the minimal time between two checks whether the
+// certificate files were changed.
+const tlsCheckInterval = time.Second
+
+// certReloader provides the TLS configuration of the manage server. It reloads
+// the certificate, the key and the client CA if one of the files was changed.
+// The files are checked during TLS handshakes, so no extra goroutine is
+// needed.
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	logger       shared.Logger
+
+	mu       sync.Mutex
+	checked  time.Time
+	modTimes []time.Time
+	config   *tls.Config
+}
+
+// newCertReloader returns a new certReloader. The files are loaded
+// immediately, so errors in the configuration are found on startup.
+func newCertReloader(certFile, keyFile, clientCAFile string, logger shared.Logger) (*certReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("certificate file and key file have to be given both")
+	}
+	r := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		logger:       logger,
+	}
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return nil, err
+	}
+	config, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.modTimes = modTimes
+	r.config = config
+	r.checked = time.Now()
+	return r, nil
+}
+
+// TLSConfig returns the TLS configuration for the manage server or nil if no
+// certificate is configured. The certificate, the key and the client CA are
+// reloaded automatically if one of the files changes.
+func TLSConfig(cfg *Config, logger shared.Logger) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		if cfg.TLSClientCAFile != "" {
+			return nil, fmt.Errorf("client CA file given without certificate and key file")
+		}
+		return nil, nil
+	}
+	r, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile, logger)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS files: %w", err)
+	}
+	return r.tlsConfig(), nil
+}
+
+// tlsConfig returns the TLS configuration for the gRPC server.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.getConfigForClient,
+	}
+}
+
+// getConfigForClient returns the current TLS configuration. It is called for
+// every TLS handshake.
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < tlsCheckInterval {
+		return r.config, nil
+	}
+	r.checked = time.Now()
+
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		r.logger.Warningf("Checking TLS files failed, using old certificate: %v", err)
+		return r.config, nil
+	}
+	if equalTimes(modTimes, r.modTimes) {
+		return r.config, nil
+	}
+
+	config, err := r.load()
+	if err != nil {
+		// The files may be written at the moment. Keep the old
+		// configuration and try again later.
+		r.logger.Warningf("Reloading TLS files failed, using old certificate: %v", err)
+		return r.config, nil
+	}
+	r.modTimes = modTimes
+	r.config = config
+	r.logger.Infof("TLS certificate reloaded from %s", r.certFile)
+	return r.config, nil
+}
+
+// load reads all files and builds the TLS configuration.
+func (r *certReloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate and key: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2"},
+	}
+
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in client CA file %q", r.clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// fileModTimes returns the modification times of all files.
+func (r *certReloader) fileModTimes() ([]time.Time, error) {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	var times []time.Time
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, fmt.Errorf("checking file %q: %w", f, err)
+		}
+		times = append(times, fi.ModTime())
+	}
+	return times, nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
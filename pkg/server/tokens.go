@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"github.com/ghodss/yaml"
+)
+
+// adminTokenName is the name of the token given by the manage auth password
+// file. This token may call all RPCs.
+const adminTokenName = "admin"
+
+// token is a named secret with a set of allowed RPCs and actions.
+type token struct {
+	Name      string   `json:"name"`
+	Token     string   `json:"token"`
+	TokenFile string   `json:"token_file"`
+	RPCs      []string `json:"rpcs"`
+	Actions   []string `json:"actions"`
+
+	// secret is the token given directly. Tokens from files are read via the
+	// secret provider, so they can be rotated.
+	secret []byte
+	file   string
+}
+
+// tokenFile is the content of the file given by MANAGE_AUTH_TOKENS_FILE.
+//
+// Example:
+//
+//	tokens:
+//	  - name: readonly
+//	    token_file: /run/secrets/manage_readonly_token
+//	    rpcs: [Get, Version, CheckServer]
+//	  - name: helpdesk
+//	    token_file: /run/secrets/manage_helpdesk_token
+//	    rpcs: [SetPassword, Action]
+//	    actions: [user.update]
+type tokenFile struct {
+	Tokens []*token `json:"tokens"`
+}
+
+// loadTokens reads the token file. It returns an error if a token is invalid
+// or if it allows an unknown RPC.
+func loadTokens(filename string, secrets *secrets.Provider) ([]*token, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading token file: %w", err)
+	}
+	var tf tokenFile
+	if err := yaml.Unmarshal(content, &tf); err != nil {
+		return nil, fmt.Errorf("unmarshalling token file: %w", err)
+	}
+
+	rpcs := make(map[string]bool)
+	for _, m := range proto.Manage_ServiceDesc.Methods {
+		rpcs[m.MethodName] = true
+	}
+
+	names := map[string]bool{adminTokenName: true}
+	for i, t := range tf.Tokens {
+		if t.Name == "" {
+			return nil, fmt.Errorf("token %d: missing name", i+1)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("token %q: name is used more than once or reserved", t.Name)
+		}
+		names[t.Name] = true
+
+		secret := []byte(t.Token)
+		switch {
+		case t.Token != "" && t.TokenFile != "":
+			return nil, fmt.Errorf("token %q: token and token_file given, only either is allowed", t.Name)
+		case t.TokenFile != "":
+			s, err := secrets.Get(t.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("token %q: reading token file: %w", t.Name, err)
+			}
+			secret = bytes.TrimSpace(s)
+			t.file = t.TokenFile
+		default:
+			t.secret = secret
+		}
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("token %q: token is empty", t.Name)
+		}
+
+		for _, rpc := range t.RPCs {
+			if !rpcs[rpc] {
+				return nil, fmt.Errorf("token %q: unknown RPC %q", t.Name, rpc)
+			}
+		}
+		for _, a := range t.Actions {
+			if _, err := path.Match(a, ""); err != nil {
+				return nil, fmt.Errorf("token %q: invalid action pattern %q: %w", t.Name, a, err)
+			}
+		}
+	}
+	return tf.Tokens, nil
+}
+
+// accepted returns the valid secrets of the token. During the grace period
+// after a change of a token file, the old value is also valid. Secrets from
+// named token files are trimmed.
+func (t *token) accepted(secrets *secrets.Provider) [][]byte {
+	if t.file == "" {
+		return [][]byte{t.secret}
+	}
+	values, err := secrets.Accepted(t.file)
+	if err != nil {
+		// Secrets are loaded on startup, so this does not happen.
+		return nil
+	}
+	if t.Name == adminTokenName {
+		return values
+	}
+	trimmed := make([][]byte, len(values))
+	for i, v := range values {
+		trimmed[i] = bytes.TrimSpace(v)
+	}
+	return trimmed
+}
+
+// findToken returns the token matching the given password or nil if there is
+// no such token. All tokens are compared to keep the time constant.
+func findToken(tokens []*token, password []byte, secrets *secrets.Provider) *token {
+	var found *token
+	for _, t := range tokens {
+		for _, secret := range t.accepted(secrets) {
+			if len(secret) > 0 && subtle.ConstantTimeCompare(password, secret) == 1 {
+				found = t
+			}
+		}
+	}
+	return found
+}
+
+// allowRPC returns an error if the token may not call the given RPC. The
+// admin token may call all RPCs.
+func (t *token) allowRPC(method string, req interface{}) error {
+	if t.Name == adminTokenName {
+		return nil
+	}
+
+	rpc := path.Base(method)
+	allowed := false
+	for _, r := range t.RPCs {
+		if r == rpc {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("token %q may not call %s", t.Name, rpc)
+	}
+
+	in, ok := req.(*proto.ActionRequest)
+	if !ok || len(t.Actions) == 0 {
+		return nil
+	}
+	for _, a := range t.Actions {
+		if ok, _ := path.Match(a, in.Action); ok { // Patterns were checked on startup.
+			return nil
+		}
+	}
+	return fmt.Errorf("token %q may not call action %q", t.Name, in.Action)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/pkg/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	tracingExporterOTLP = "otlp"
+	tracingExporterFile = "file"
+)
+
+// setupTracing sets the span exporter given in the config. The returned
+// function flushes and closes the exporter.
+func setupTracing(cfg *Config, logger shared.Logger) (func() error, error) {
+	onError := func(err error) {
+		logger.Warningf("Exporting spans: %v", err)
+	}
+
+	switch cfg.TracingExporter {
+	case "":
+		return func() error { return nil }, nil
+
+	case tracingExporterOTLP:
+		e := tracing.NewOTLPExporter(cfg.TracingOTLPEndpoint, onError)
+		tracing.SetExporter(e)
+		logger.Infof("Manage service exports spans to %s\n", cfg.TracingOTLPEndpoint)
+		return e.Close, nil
+
+	case tracingExporterFile:
+		if cfg.TracingFile == "" {
+			return nil, fmt.Errorf("tracing exporter %q needs MANAGE_TRACING_FILE", tracingExporterFile)
+		}
+		e, err := tracing.NewFileExporter(cfg.TracingFile, onError)
+		if err != nil {
+			return nil, fmt.Errorf("creating file exporter: %w", err)
+		}
+		tracing.SetExporter(e)
+		logger.Infof("Manage service writes spans to %s\n", cfg.TracingFile)
+		return e.Close, nil
+
+	default:
+		return nil, fmt.Errorf("invalid tracing exporter %q, expected %q or %q", cfg.TracingExporter, tracingExporterOTLP, tracingExporterFile)
+	}
+}
+
+// tracingUnaryInterceptor starts a span for every call. A W3C traceparent
+// given by the client in the metadata is used as parent.
+func tracingUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if tp := md.Get(tracing.TraceparentHeader); len(tp) > 0 {
+			ctx = tracing.Extract(ctx, tp[0])
+		}
+	}
+
+	ctx, span := tracing.Start(ctx, strings.TrimPrefix(info.FullMethod, "/"), tracing.KindServer)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", info.FullMethod)
+	defer func() {
+		span.SetAttribute("rpc.grpc.status_code", int(status.Code(err)))
+		span.Finish(err)
+	}()
+
+	return handler(ctx, req)
+}
@@ -7,11 +7,12 @@ import (
 	"strings"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
 	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
 )
 
 const (
@@ -62,10 +63,10 @@ func Cmd() *cobra.Command {
 			return fmt.Errorf("reading payload from positional argument or file or stdin: %w", err)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := cp.Dial(ctx)
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -98,7 +99,7 @@ type gRPCClient interface {
 func Run(ctx context.Context, gc gRPCClient, action string, payload []byte) error {
 	actionName, ok := actionMap[action]
 	if !ok {
-		return fmt.Errorf("unknown action %q", action)
+		return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("unknown action %q", action))
 	}
 	in := &proto.ActionRequest{
 		Action:  actionName,
@@ -107,9 +108,9 @@ func Run(ctx context.Context, gc gRPCClient, action string, payload []byte) erro
 
 	resp, err := gc.Action(ctx, in)
 	if err != nil {
-		s, _ := status.FromError(err) // The ok value does not matter here.
-		return fmt.Errorf("calling manage service (calling backend action): %s", s.Message())
+		return fmt.Errorf("calling manage service (calling backend action): %w", fehler.FromGRPC(err))
 	}
-	fmt.Printf("Request was successful with following response: %s\n", string(resp.Payload))
-	return nil
+	p := output.FromContext(ctx)
+	p.Printf("Request was successful with following response: %s\n", string(resp.Payload))
+	return p.Result(output.RawJSON(resp.Payload))
 }
@@ -6,10 +6,12 @@ import (
 	"fmt"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/codes"
 )
 
 const (
@@ -37,10 +39,10 @@ func Cmd() *cobra.Command {
 	cmd.MarkFlagRequired("password")
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := cp.Dial(ctx)
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -67,10 +69,11 @@ func Run(ctx context.Context, gc gRPCClient, userID int64, password string) erro
 		Password: password,
 	}
 	if _, err := gc.SetPassword(ctx, in); err != nil {
-		s, _ := status.FromError(err) // The ok value does not matter here.
-		return fmt.Errorf("calling manage service (setting password of user %d): %s", userID, s.Message())
+		return fmt.Errorf("calling manage service (setting password of user %d): %w", userID, fehler.FromGRPC(err))
 	}
-	return nil
+	p := output.FromContext(ctx)
+	p.Printf("Password of user %d was set successfully.\n", userID)
+	return p.Result(map[string]int64{"user_id": userID})
 }
 
 // Server
@@ -82,6 +85,9 @@ type backendAction interface {
 // SetPassword gets the hash and sets the password for the given user.
 // This function is the server side entrypoint for this package.
 func SetPassword(ctx context.Context, in *proto.SetPasswordRequest, ba backendAction) (*proto.SetPasswordResponse, error) {
+	if in.UserID <= 0 {
+		return nil, fehler.WithCode(codes.InvalidArgument, fmt.Errorf("invalid user id %d", in.UserID))
+	}
 	if err := Execute(ctx, in.UserID, in.Password, ba); err != nil {
 		return nil, fmt.Errorf("setting password for user %d: %w", in.UserID, err)
 	}
@@ -18,14 +18,15 @@ import (
 	"time"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
 	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
 	"github.com/spf13/cobra"
 )
 
 const (
-	subDirPerms  fs.FileMode = 0770
-	certCertName             = "cert_crt"
-	certKeyName              = "cert_key"
+	subDirPerms fs.FileMode = 0770
+	certKeyName             = "cert_key"
 )
 
 const (
@@ -35,11 +36,20 @@ const (
 	// SetupHelpExtra contains the long help text for the command without the headline.
 	SetupHelpExtra = `This command creates a container configuration YAML file. It also creates the
 required secrets and directories for volumes containing persistent database and
-SSL certs. Everything is created in the given directory.`
+SSL certs. Everything is created in the given directory.
+
+With --encrypt the secrets are encrypted with the passphrase from
+OPENSLIDES_KEYSTORE_PASSPHRASE_FILE or OPENSLIDES_KEYSTORE_PASSPHRASE into files
+with the suffix .enc, so the directory can be committed. Use
+"openslides secrets decrypt" to get the plaintext files.`
 
 	// SecretsDirName is the name of the directory for Docker Secrets.
 	SecretsDirName = "secrets"
 
+	// CertCertName is the name of the secrets file containing the certificate
+	// of the proxy.
+	CertCertName = "cert_crt"
+
 	// SuperadminFileName is the name of the secrets file containing the superadmin password.
 	SuperadminFileName = "superadmin"
 
@@ -61,6 +71,7 @@ func Cmd() *cobra.Command {
 	}
 
 	force := cmd.Flags().BoolP("force", "f", false, "do not skip existing files but overwrite them")
+	encrypt := cmd.Flags().Bool("encrypt", false, "encrypt the secrets with the passphrase from the environment")
 	tplFileName := config.FlagTpl(cmd)
 	configFileNames := config.FlagConfig(cmd)
 
@@ -87,6 +98,17 @@ func Cmd() *cobra.Command {
 			}
 		}
 
+		if *encrypt {
+			passphrase, err := secrets.KeystorePassphrase()
+			if err != nil {
+				return fehler.ExitCode(fehler.ExitValidation, err)
+			}
+			if err := SetupEncrypted(dir, *force, tplFile, configFiles, secrets.NewCipher(passphrase)); err != nil {
+				return fmt.Errorf("running SetupEncrypted(): %w", err)
+			}
+			return nil
+		}
+
 		if err := Setup(dir, *force, tplFile, configFiles); err != nil {
 			return fmt.Errorf("running Setup(): %w", err)
 		}
@@ -101,6 +123,17 @@ func Cmd() *cobra.Command {
 // Existing files are skipped unless force is true. A custom template for the YAML file
 // and YAML configs can be provided.
 func Setup(dir string, force bool, tplFile []byte, configFiles [][]byte) error {
+	return setup(dir, force, tplFile, configFiles, nil)
+}
+
+// SetupEncrypted is like Setup but encrypts all secrets with the cipher. The
+// secret files get the suffix .enc and a .gitignore file ignores plaintext
+// files in the secrets directory.
+func SetupEncrypted(dir string, force bool, tplFile []byte, configFiles [][]byte, c *secrets.Cipher) error {
+	return setup(dir, force, tplFile, configFiles, c)
+}
+
+func setup(dir string, force bool, tplFile []byte, configFiles [][]byte, c *secrets.Cipher) error {
 	// Create directory
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return fmt.Errorf("creating directory at %q: %w", dir, err)
@@ -123,26 +156,52 @@ func Setup(dir string, force bool, tplFile []byte, configFiles [][]byte) error {
 	}
 
 	// Create random secrets
-	if err := createRandomSecrets(secrDir, force); err != nil {
+	if err := createRandomSecrets(secrDir, force, c); err != nil {
 		return fmt.Errorf("creating random secrets: %w", err)
 	}
 
 	// Create certificates
 	if *cfg.EnableLocalHTTPS {
-		if err := createCerts(secrDir, force); err != nil {
+		if err := createCerts(secrDir, force, c); err != nil {
 			return fmt.Errorf("creating certificates: %w", err)
 		}
 	}
 
 	// Create superadmin file
-	if err := shared.CreateFile(secrDir, force, SuperadminFileName, []byte(DefaultSuperadminPassword)); err != nil {
+	if err := createSecretFile(secrDir, force, SuperadminFileName, []byte(DefaultSuperadminPassword), c); err != nil {
 		return fmt.Errorf("creating admin file at %q: %w", dir, err)
 	}
 
+	if c != nil {
+		if err := secrets.WriteGitignore(secrDir, force); err != nil {
+			return fmt.Errorf("creating .gitignore at %q: %w", secrDir, err)
+		}
+	}
+
 	return nil
 }
 
-func createRandomSecrets(dir string, force bool) error {
+// createSecretFile creates a secret file in the given directory. If the
+// cipher is not nil, the content is encrypted and the suffix .enc is added to
+// the name.
+func createSecretFile(dir string, force bool, name string, content []byte, c *secrets.Cipher) error {
+	if c == nil {
+		return shared.CreateFile(dir, force, name, content)
+	}
+
+	encName := name + secrets.EncryptedSuffix
+	if _, err := os.Stat(path.Join(dir, encName)); err == nil && !force {
+		// No force-mode and file already exists, so skip this file.
+		return nil
+	}
+	encContent, err := c.Encrypt(content)
+	if err != nil {
+		return fmt.Errorf("encrypting secret %q: %w", name, err)
+	}
+	return shared.CreateFile(dir, true, encName, encContent)
+}
+
+func createRandomSecrets(dir string, force bool, c *secrets.Cipher) error {
 	secs := []struct {
 		filename string
 	}{
@@ -157,7 +216,7 @@ func createRandomSecrets(dir string, force bool) error {
 		if err != nil {
 			return fmt.Errorf("creating random secret %q: %w", s.filename, err)
 		}
-		if err := shared.CreateFile(dir, force, s.filename, secrToken); err != nil {
+		if err := createSecretFile(dir, force, s.filename, secrToken, c); err != nil {
 			return fmt.Errorf("creating secret file %q at %q: %w", dir, s.filename, err)
 		}
 	}
@@ -176,7 +235,7 @@ func randomSecret() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func createCerts(dir string, force bool) error {
+func createCerts(dir string, force bool, c *secrets.Cipher) error {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return fmt.Errorf("generating key: %w", err)
@@ -206,8 +265,8 @@ func createCerts(dir string, force bool) error {
 	if err := pem.Encode(buf1, &pem.Block{Type: "CERTIFICATE", Bytes: certData}); err != nil {
 		return fmt.Errorf("encoding certificate data: %w", err)
 	}
-	if err := shared.CreateFile(dir, force, certCertName, buf1.Bytes()); err != nil {
-		return fmt.Errorf("creating certificate file %q at %q: %w", certCertName, dir, err)
+	if err := createSecretFile(dir, force, CertCertName, buf1.Bytes(), c); err != nil {
+		return fmt.Errorf("creating certificate file %q at %q: %w", CertCertName, dir, err)
 	}
 
 	keyData, err := x509.MarshalPKCS8PrivateKey(key)
@@ -218,7 +277,7 @@ func createCerts(dir string, force bool) error {
 	if err := pem.Encode(buf2, &pem.Block{Type: "PRIVATE KEY", Bytes: keyData}); err != nil {
 		return fmt.Errorf("encoding key data: %w", err)
 	}
-	if err := shared.CreateFile(dir, force, certKeyName, buf2.Bytes()); err != nil {
+	if err := createSecretFile(dir, force, certKeyName, buf2.Bytes(), c); err != nil {
 		return fmt.Errorf("creating key file %q at %q: %w", certKeyName, dir, err)
 	}
 
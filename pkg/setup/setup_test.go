@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
 )
 
@@ -789,6 +790,31 @@ secrets:
 `)
 }
 
+func TestSetupEncrypted(t *testing.T) {
+	testDir := t.TempDir()
+	c := secrets.NewCipher([]byte("passphrase"))
+	if err := setup.SetupEncrypted(testDir, false, nil, nil, c); err != nil {
+		t.Fatalf("running SetupEncrypted() failed with error: %v", err)
+	}
+
+	secDir := path.Join(testDir, setup.SecretsDirName)
+	if _, err := os.Stat(path.Join(secDir, setup.ManageAuthPasswordFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("plaintext secret should not exist, got error %v", err)
+	}
+	if _, err := os.Stat(path.Join(secDir, ".gitignore")); err != nil {
+		t.Fatalf("missing .gitignore: %v", err)
+	}
+
+	dst := t.TempDir()
+	if _, err := secrets.DecryptDir(secDir, dst, c); err != nil {
+		t.Fatalf("decrypting secrets: %v", err)
+	}
+	testKeyFile(t, dst, "auth_token_key")
+	testKeyFile(t, dst, "manage_auth_password")
+	testPasswordFile(t, dst, "postgres_password")
+	testContentFile(t, dst, setup.SuperadminFileName, setup.DefaultSuperadminPassword)
+}
+
 func TestSetupNoDirectory(t *testing.T) {
 	hasErrMsg := "not a directory"
 	err := setup.Setup("setup_test.go", false, nil, nil)
@@ -0,0 +1,228 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	lvlDebug    = 1
+	lvlInfo     = 2
+	lvlWarning  = 3
+	lvlError    = 4
+	lvlCritical = 5
+)
+
+var levelNames = map[int]string{
+	lvlDebug:    "debug",
+	lvlInfo:     "info",
+	lvlWarning:  "warning",
+	lvlError:    "error",
+	lvlCritical: "critical",
+}
+
+const (
+	// LogFormatText prints lines like the standard library logger, e. g.
+	// `2006/01/02 15:04:05 [INFO] message key=value`.
+	LogFormatText = "text"
+
+	// LogFormatJSON prints one JSON object per line.
+	LogFormatJSON = "json"
+
+	// LogFormatLogfmt prints lines with key=value pairs.
+	LogFormatLogfmt = "logfmt"
+)
+
+// field is a key value pair that is added to every log line.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// Logger is a logger that provides logging with respect to the log level.
+type Logger struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	lvl    int
+	format string
+	fields []field
+}
+
+// NewLogger returns a logger with respect to the given log level and format
+// that writes to stderr.
+func NewLogger(level, format string) (Logger, error) {
+	return NewLoggerWithWriter(os.Stderr, level, format)
+}
+
+// NewLoggerWithWriter returns a logger with respect to the given log level
+// and format that writes to the given writer.
+func NewLoggerWithWriter(w io.Writer, level, format string) (Logger, error) {
+	lvl := 0
+	for l, name := range levelNames {
+		if strings.ToLower(level) == name {
+			lvl = l
+		}
+	}
+	if lvl == 0 {
+		return Logger{}, fmt.Errorf("invalid log level %q", level)
+	}
+
+	switch format {
+	case LogFormatText, LogFormatJSON, LogFormatLogfmt:
+	default:
+		return Logger{}, fmt.Errorf("invalid log format %q", format)
+	}
+
+	l := Logger{
+		w:      w,
+		mu:     new(sync.Mutex),
+		lvl:    lvl,
+		format: format,
+	}
+	return l, nil
+}
+
+// With returns a new logger that adds the given key value pair to every log
+// line.
+func (l Logger) With(key string, value interface{}) Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+1)
+	copy(fields, l.fields)
+	l.fields = append(fields, field{key: key, value: value})
+	return l
+}
+
+// Debugf logs a message but only in case of log level debug.
+func (l Logger) Debugf(format string, v ...interface{}) {
+	l.logf(lvlDebug, format, v...)
+}
+
+// Infof logs a message but only in case of log level info or lower.
+func (l Logger) Infof(format string, v ...interface{}) {
+	l.logf(lvlInfo, format, v...)
+}
+
+// Warningf logs a message but only in case of log level warning or lower.
+func (l Logger) Warningf(format string, v ...interface{}) {
+	l.logf(lvlWarning, format, v...)
+}
+
+// Errorf logs a message but only in case of log level error or lower.
+func (l Logger) Errorf(format string, v ...interface{}) {
+	l.logf(lvlError, format, v...)
+}
+
+// Criticalf logs a message in every log level.
+func (l Logger) Criticalf(format string, v ...interface{}) {
+	l.logf(lvlCritical, format, v...)
+}
+
+func (l Logger) logf(lvl int, format string, v ...interface{}) {
+	if l.w == nil || lvl < l.lvl {
+		return
+	}
+	msg := strings.TrimRight(fmt.Sprintf(format, v...), "\n")
+	now := time.Now()
+
+	var line string
+	switch l.format {
+	case LogFormatJSON:
+		line = l.jsonLine(now, lvl, msg)
+	case LogFormatLogfmt:
+		line = l.logfmtLine(now, lvl, msg)
+	default:
+		line = l.textLine(now, lvl, msg)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, line+"\n")
+}
+
+func (l Logger) textLine(now time.Time, lvl int, msg string) string {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "%s [%s] %s", now.Format("2006/01/02 15:04:05"), strings.ToUpper(levelNames[lvl]), msg)
+	for _, f := range l.fields {
+		fmt.Fprintf(b, " %s=%s", f.key, logfmtValue(f.value))
+	}
+	return b.String()
+}
+
+func (l Logger) logfmtLine(now time.Time, lvl int, msg string) string {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "time=%s level=%s msg=%s", now.Format(time.RFC3339Nano), levelNames[lvl], logfmtValue(msg))
+	for _, f := range l.fields {
+		fmt.Fprintf(b, " %s=%s", f.key, logfmtValue(f.value))
+	}
+	return b.String()
+}
+
+func (l Logger) jsonLine(now time.Time, lvl int, msg string) string {
+	line := map[string]interface{}{
+		"time":  now.Format(time.RFC3339Nano),
+		"level": levelNames[lvl],
+		"msg":   msg,
+	}
+	for _, f := range l.fields {
+		line[f.key] = f.value
+	}
+	encLine, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Sprintf(`{"level":"error","msg":%q}`, "encoding log line: "+err.Error())
+	}
+	return string(encLine)
+}
+
+// logfmtValue formats the value and quotes it if necessary.
+func logfmtValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// WithLogger returns a new context that carries the given logger.
+func WithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// defaultLogger is used for contexts without logger. It logs with level info
+// in text format until SetDefaultLogger is called.
+var defaultLogger = struct {
+	mu sync.RWMutex
+	l  Logger
+}{l: Logger{w: os.Stderr, mu: new(sync.Mutex), lvl: lvlInfo, format: LogFormatText}}
+
+// SetDefaultLogger sets the logger that is used for contexts without logger.
+// The server calls it once at startup with its configured logger.
+func SetDefaultLogger(l Logger) {
+	defaultLogger.mu.Lock()
+	defer defaultLogger.mu.Unlock()
+	defaultLogger.l = l
+}
+
+// LoggerFromContext returns the logger of the given context. If the context
+// does not carry a logger, the default logger is returned, see
+// SetDefaultLogger.
+func LoggerFromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey).(Logger); ok {
+		return l
+	}
+	defaultLogger.mu.RLock()
+	defer defaultLogger.mu.RUnlock()
+	return defaultLogger.l
+}
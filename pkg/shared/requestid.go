@@ -0,0 +1,31 @@
+package shared
+
+import (
+	"context"
+	"net/http"
+)
+
+// RequestIDHeader is the HTTP header and (in lower case) the gRPC metadata key
+// for the id of a request. The id is used to find all log lines of a request
+// in all services.
+const RequestIDHeader = "X-Request-ID"
+
+// WithRequestID returns a new context that carries the given request id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request id of the context or an empty
+// string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// InjectRequestID sets the request id header if the context carries a request
+// id.
+func InjectRequestID(ctx context.Context, h http.Header) {
+	if id := RequestIDFromContext(ctx); id != "" {
+		h.Set(RequestIDHeader, id)
+	}
+}
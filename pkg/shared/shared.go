@@ -7,17 +7,11 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
 	"os"
 	"path"
-	"strconv"
-	"strings"
-)
 
-// developmentPassword is the password used if environment variable
-// OPENSLIDES_DEVELOPMENT is set to one of the following values: 1, t, T, TRUE,
-// true, True.
-const developmentPassword = "openslides"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+)
 
 // AuthHeader is the name of the header that contains the basic authoriztation password.
 const AuthHeader = "authorization"
@@ -61,10 +55,10 @@ func fileExists(p string) (bool, error) {
 // be "-" so we read from stdin) and returns the content.
 func InputOrFileOrStdin(input, filename string) ([]byte, error) {
 	if input == "" && filename == "" {
-		return nil, fmt.Errorf("input and filename must not both be empty")
+		return nil, fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("input and filename must not both be empty"))
 	}
 	if input != "" && filename != "" {
-		return nil, fmt.Errorf("input or filename must be empty")
+		return nil, fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("input or filename must be empty"))
 	}
 
 	if input != "" {
@@ -97,22 +91,6 @@ func ReadFromFileOrStdin(filename string) ([]byte, error) {
 	return content, nil
 }
 
-// AuthSecret returns a secret using the secret file as given in
-// environment variable. In case of development it uses the development
-// password.
-func AuthSecret(pwFile string, devEnv string) ([]byte, error) {
-	if dev, _ := strconv.ParseBool(devEnv); dev {
-		// Error value does not matter here. In case of an error dev is false and
-		// this is the expected behavior.
-		return []byte(developmentPassword), nil
-	}
-	pw, err := os.ReadFile(pwFile)
-	if err != nil {
-		return nil, fmt.Errorf("reading secret file %q: %w", pwFile, err)
-	}
-	return pw, nil
-}
-
 // BasicAuth contains the password used in basic authorization process. The password will be encoded in base64.
 // The struct implements https://pkg.go.dev/google.golang.org/grpc@v1.38.0/credentials#PerRPCCredentials
 type BasicAuth struct {
@@ -137,58 +115,3 @@ func (a BasicAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[s
 func (a BasicAuth) RequireTransportSecurity() bool {
 	return false
 }
-
-const (
-	lvlDebug    = 1
-	lvlInfo     = 2
-	lvlWarning  = 3
-	lvlError    = 4
-	lvlCritical = 5
-)
-
-// Logger is a logger that provides logging with respect to the log level.
-type Logger struct {
-	logger *log.Logger
-	lvl    int
-}
-
-// NewLogger returns a default logger with respect to the given log level.
-func NewLogger(level string) (Logger, error) {
-	lvl := 0
-	switch strings.ToLower(level) {
-	case "debug":
-		lvl = lvlDebug
-	case "info":
-		lvl = lvlInfo
-	case "warning":
-		lvl = lvlWarning
-	case "error":
-		lvl = lvlError
-	case "critical":
-		lvl = 5
-	default:
-		return Logger{}, fmt.Errorf("invalid log level %q", level)
-	}
-	l := Logger{
-		logger: log.Default(),
-		lvl:    lvl,
-	}
-	return l, nil
-
-}
-
-// Debugf calls logger.Printf but only in case of log level debug.
-func (l Logger) Debugf(format string, v ...interface{}) {
-	if l.lvl == lvlDebug {
-		l.logger.Printf("[DEBUG] "+format, v...)
-	}
-}
-
-// Infof calls logger.Printf but only in case of log level info or lower.
-func (l Logger) Infof(format string, v ...interface{}) {
-	if l.lvl <= lvlInfo {
-		l.logger.Printf("[INFO] "+format, v...)
-	}
-}
-
-// TODO: Add methods for warning, error and critical
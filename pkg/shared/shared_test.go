@@ -2,6 +2,8 @@ package shared_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"os"
 	"path"
@@ -191,3 +193,74 @@ func TestInputOrFileOrStdin(t *testing.T) {
 		}
 	})
 }
+
+func TestLogger(t *testing.T) {
+	t.Run("log level", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		l, err := shared.NewLoggerWithWriter(buf, "warning", shared.LogFormatText)
+		if err != nil {
+			t.Fatalf("creating logger: %v", err)
+		}
+		l.Infof("not logged")
+		l.Warningf("logged %d", 1)
+		l.Criticalf("logged %d", 2)
+		got := buf.String()
+		if strings.Contains(got, "not logged") || !strings.Contains(got, "[WARNING] logged 1") || !strings.Contains(got, "[CRITICAL] logged 2") {
+			t.Fatalf("wrong log output: %q", got)
+		}
+	})
+
+	t.Run("JSON format with fields", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		l, err := shared.NewLoggerWithWriter(buf, "debug", shared.LogFormatJSON)
+		if err != nil {
+			t.Fatalf("creating logger: %v", err)
+		}
+		l.With("rpc", "/Manage/Get").Errorf("some error")
+		var got map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("decoding log line %q: %v", buf.String(), err)
+		}
+		if got["level"] != "error" || got["msg"] != "some error" || got["rpc"] != "/Manage/Get" {
+			t.Fatalf("wrong log line: %q", buf.String())
+		}
+	})
+
+	t.Run("logfmt format", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		l, err := shared.NewLoggerWithWriter(buf, "info", shared.LogFormatLogfmt)
+		if err != nil {
+			t.Fatalf("creating logger: %v", err)
+		}
+		l.With("request_id", "abc").Infof("some message")
+		if !strings.Contains(buf.String(), `level=info msg="some message" request_id=abc`) {
+			t.Fatalf("wrong log line: %q", buf.String())
+		}
+	})
+
+	t.Run("default logger", func(t *testing.T) {
+		old := shared.LoggerFromContext(context.Background())
+		t.Cleanup(func() { shared.SetDefaultLogger(old) })
+
+		buf := new(bytes.Buffer)
+		l, err := shared.NewLoggerWithWriter(buf, "warning", shared.LogFormatJSON)
+		if err != nil {
+			t.Fatalf("creating logger: %v", err)
+		}
+		shared.SetDefaultLogger(l)
+		shared.LoggerFromContext(context.Background()).Infof("not logged")
+		shared.LoggerFromContext(context.Background()).Warningf("some warning")
+		if strings.Contains(buf.String(), "not logged") || !strings.Contains(buf.String(), `"msg":"some warning"`) {
+			t.Fatalf("wrong log output of default logger: %q", buf.String())
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		if _, err := shared.NewLogger("verbose", shared.LogFormatText); err == nil {
+			t.Fatalf("creating logger with invalid level should fail")
+		}
+		if _, err := shared.NewLogger("info", "xml"); err == nil {
+			t.Fatalf("creating logger with invalid format should fail")
+		}
+	})
+}
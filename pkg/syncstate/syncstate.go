@@ -0,0 +1,742 @@
+package syncstate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
+
+const (
+	// SyncHelp contains the short help text for the command.
+	SyncHelp = "Reconciles organization data with a declarative desired state"
+
+	// SyncHelpExtra contains the long help text for the command without
+	// the headline.
+	SyncHelpExtra = `This command reads a YAML or JSON file describing organization tags,
+committees, meetings, groups and users. It reads the current state from the
+datastore, prints a plan of necessary changes and applies them via backend
+actions. Use - as filename to read the desired state from stdin.
+
+Objects are identified by their name (users by their username, meetings within
+their committee and groups within their meeting). Fields that are not given in
+the desired state are left untouched. Objects missing in the desired state are
+only deleted if their collection is listed under prune. Meetings and groups are
+only pruned within the committees and meetings given in the desired state. The
+default and admin groups of meetings and users with an organization management
+level are never pruned.
+
+Example:
+  organization_tags:
+    - name: Berlin
+      color: "#2196f3"
+  committees:
+    - name: Board
+      organization_tags: [Berlin]
+  meetings:
+    - name: Annual general meeting
+      committee: Board
+      language: en
+      admin_ids: [1]
+  groups:
+    - name: Delegates
+      meeting: Annual general meeting
+      permissions: [motion.can_see]
+  users:
+    - username: jdoe
+      first_name: Jane
+      last_name: Doe
+      default_password: secret`
+)
+
+// Cmd returns the subcommand.
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync desired-state",
+		Short: SyncHelp,
+		Long:  SyncHelp + "\n\n" + SyncHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+	cp := connection.Unary(cmd)
+
+	dryRun := cmd.Flags().Bool("dry-run", false, "only print the plan but do not apply it")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		content, err := shared.ReadFromFileOrStdin(args[0])
+		if err != nil {
+			return fmt.Errorf("reading desired state file: %w", err)
+		}
+		d, err := ParseDesired(content)
+		if err != nil {
+			return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("parsing desired state file: %w", err))
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
+		defer cancel()
+
+		cl, close, err := cp.Dial(ctx)
+		if err != nil {
+			return fmt.Errorf("connecting to gRPC server: %w", err)
+		}
+		defer close()
+
+		if err := Run(ctx, cl, d, *dryRun); err != nil {
+			return fmt.Errorf("synchronizing desired state: %w", err)
+		}
+		return nil
+	}
+	return cmd
+}
+
+// Desired state
+
+// Object is a single object of the desired or current state.
+type Object map[string]interface{}
+
+// Desired contains the declarative description of the organization data.
+type Desired struct {
+	OrganizationTags []Object `json:"organization_tags"`
+	Committees       []Object `json:"committees"`
+	Meetings         []Object `json:"meetings"`
+	Groups           []Object `json:"groups"`
+	Users            []Object `json:"users"`
+
+	// Prune lists the collections where objects that are missing in the
+	// desired state are deleted.
+	Prune []string `json:"prune"`
+}
+
+// ParseDesired parses the given YAML or JSON desired state.
+func ParseDesired(content []byte) (*Desired, error) {
+	c, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("converting YAML to JSON: %w", err)
+	}
+	d := new(Desired)
+	if err := json.Unmarshal(c, d); err != nil {
+		return nil, fmt.Errorf("unmarshalling desired state: %w", err)
+	}
+	for _, p := range d.Prune {
+		if _, ok := collectionByName(p); !ok {
+			return nil, fmt.Errorf("unknown collection %q in prune", p)
+		}
+	}
+	for _, c := range collections {
+		for i, item := range d.items(c.name) {
+			if _, ok := item[c.labelField].(string); !ok {
+				return nil, fmt.Errorf("%s %d: missing %s", c.name, i+1, c.labelField)
+			}
+		}
+	}
+	return d, nil
+}
+
+func (d *Desired) items(collection string) []Object {
+	switch collection {
+	case "organization_tag":
+		return d.OrganizationTags
+	case "committee":
+		return d.Committees
+	case "meeting":
+		return d.Meetings
+	case "group":
+		return d.Groups
+	case "user":
+		return d.Users
+	}
+	return nil
+}
+
+func (d *Desired) prunes(collection string) bool {
+	for _, p := range d.Prune {
+		if p == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// collection describes how objects of a collection are identified and how
+// they reference other collections.
+type collection struct {
+	name string
+
+	// labelField is the field with the (human readable) name of an object.
+	// Other objects reference this object by the value of this field.
+	labelField string
+
+	// parent is the field with the id of the parent object if the label is
+	// only unique within the parent.
+	parent string
+
+	refs []reference
+
+	// createDefaults are added to the payload of create actions if they are
+	// not given.
+	createDefaults Object
+
+	// createOnly are fields that are only parameters of the create action
+	// and are not stored. They are ignored for existing objects.
+	createOnly []string
+
+	// protected are fields that mark objects which are never pruned, e. g.
+	// the default group of a meeting. An object is protected if one of these
+	// fields is set.
+	protected []string
+}
+
+func (c collection) isCreateOnly(field string) bool {
+	for _, f := range c.createOnly {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (c collection) isProtected(obj Object) bool {
+	for _, f := range c.protected {
+		switch v := obj[f].(type) {
+		case nil:
+		case string:
+			if v != "" {
+				return true
+			}
+		case float64:
+			if v != 0 {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// reference maps a field of the desired state containing a name (or a list of
+// names) to the respective id field in OpenSlides.
+type reference struct {
+	field   string
+	target  string
+	idField string
+	many    bool
+}
+
+// collections contains all supported collections in the order they are
+// created and updated. Deletes are applied in reverse order.
+var collections = []collection{
+	{
+		name:           "organization_tag",
+		labelField:     "name",
+		createDefaults: Object{"organization_id": 1},
+	},
+	{
+		name:       "committee",
+		labelField: "name",
+		refs: []reference{
+			{field: "organization_tags", target: "organization_tag", idField: "organization_tag_ids", many: true},
+		},
+		createDefaults: Object{"organization_id": 1},
+	},
+	{
+		name:       "meeting",
+		labelField: "name",
+		parent:     "committee_id",
+		refs: []reference{
+			{field: "committee", target: "committee", idField: "committee_id"},
+			{field: "organization_tags", target: "organization_tag", idField: "organization_tag_ids", many: true},
+		},
+		createOnly: []string{"admin_ids"},
+	},
+	{
+		name:       "group",
+		labelField: "name",
+		parent:     "meeting_id",
+		refs: []reference{
+			{field: "meeting", target: "meeting", idField: "meeting_id"},
+		},
+		protected: []string{"default_group_for_meeting_id", "admin_group_for_meeting_id"},
+	},
+	{
+		name:       "user",
+		labelField: "username",
+		protected:  []string{"organization_management_level"},
+	},
+}
+
+func collectionByName(name string) (collection, bool) {
+	for _, c := range collections {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return collection{}, false
+}
+
+// Plan
+
+// pending is the id of an object that is created while the plan is applied.
+// Until then it is marshalled as placeholder.
+type pending struct {
+	label string
+	id    int
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p *pending) MarshalJSON() ([]byte, error) {
+	if p.id == 0 {
+		return json.Marshal("new:" + p.label)
+	}
+	return json.Marshal(p.id)
+}
+
+const (
+	opCreate = "create"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// Change is a single create, update or delete operation.
+type Change struct {
+	Op         string
+	Collection string
+	Label      string
+	ID         int
+	Payload    Object
+
+	created *pending
+}
+
+// Action returns the name of the backend action for this change.
+func (c Change) Action() string {
+	return c.Collection + "." + c.Op
+}
+
+// String returns a human readable description of this change.
+func (c Change) String() string {
+	encPayload, _ := json.Marshal(c.Payload) // The payload only contains JSON values.
+	switch c.Op {
+	case opCreate:
+		return fmt.Sprintf("+ create %s %q: %s", c.Collection, c.Label, encPayload)
+	case opUpdate:
+		return fmt.Sprintf("~ update %s %q (id %d): %s", c.Collection, c.Label, c.ID, encPayload)
+	default:
+		return fmt.Sprintf("- delete %s %q (id %d)", c.Collection, c.Label, c.ID)
+	}
+}
+
+// State contains the current objects of all collections by id.
+type State map[string]map[int]Object
+
+// index maps the labels of the objects of all collections to their ids. An id
+// is either an int or a *pending.
+type index map[string]map[string][]interface{}
+
+func (idx index) add(collection, label string, id interface{}) {
+	if idx[collection] == nil {
+		idx[collection] = make(map[string][]interface{})
+	}
+	idx[collection][label] = append(idx[collection][label], id)
+}
+
+func (idx index) lookup(collection, label string) (interface{}, error) {
+	ids := idx[collection][label]
+	switch len(ids) {
+	case 0:
+		return nil, fmt.Errorf("%s %q does not exist", collection, label)
+	case 1:
+		return ids[0], nil
+	default:
+		return nil, fmt.Errorf("%s %q is ambiguous", collection, label)
+	}
+}
+
+// Diff computes the changes that are necessary to reach the desired state from
+// the current state.
+func Diff(d *Desired, current State) ([]Change, error) {
+	idx := make(index)
+	for _, c := range collections {
+		for id, obj := range current[c.name] {
+			if label, ok := obj[c.labelField].(string); ok {
+				idx.add(c.name, label, id)
+			}
+		}
+	}
+
+	var changes []Change
+	var deletes [][]Change
+	matchedIDs := make(map[string]map[int]bool)
+	for _, c := range collections {
+		matched := make(map[int]bool)
+		matchedIDs[c.name] = matched
+		for i, item := range d.items(c.name) {
+			fields, err := resolveReferences(c, item, idx)
+			if err != nil {
+				return nil, fmt.Errorf("%s %d: %w", c.name, i+1, err)
+			}
+			label := fields[c.labelField].(string)
+
+			id, obj, ok := match(c, fields, current[c.name])
+			if !ok {
+				p := &pending{label: c.name + ":" + label}
+				idx.add(c.name, label, p)
+				payload := make(Object, len(fields)+len(c.createDefaults))
+				for k, v := range c.createDefaults {
+					payload[k] = v
+				}
+				for k, v := range fields {
+					payload[k] = v
+				}
+				changes = append(changes, Change{Op: opCreate, Collection: c.name, Label: label, Payload: payload, created: p})
+				continue
+			}
+			if matched[id] {
+				return nil, fmt.Errorf("%s %d: %q is given more than once", c.name, i+1, label)
+			}
+			matched[id] = true
+
+			payload := Object{}
+			for k, v := range fields {
+				if c.isCreateOnly(k) {
+					continue
+				}
+				if !equal(v, obj[k]) {
+					payload[k] = v
+				}
+			}
+			if len(payload) > 0 {
+				payload["id"] = id
+				changes = append(changes, Change{Op: opUpdate, Collection: c.name, Label: label, ID: id, Payload: payload})
+			}
+		}
+
+		if !d.prunes(c.name) {
+			continue
+		}
+		var del []Change
+		for _, id := range sortedIDs(current[c.name]) {
+			obj := current[c.name][id]
+			if matched[id] || c.isProtected(obj) {
+				continue
+			}
+			if c.parent != "" {
+				// Only objects within parents of the desired state are pruned.
+				parentID, ok := toID(obj[c.parent])
+				if !ok || !matchedIDs[strings.TrimSuffix(c.parent, "_id")][parentID] {
+					continue
+				}
+			}
+			label, _ := obj[c.labelField].(string)
+			del = append(del, Change{Op: opDelete, Collection: c.name, Label: label, ID: id, Payload: Object{"id": id}})
+		}
+		deletes = append(deletes, del)
+	}
+
+	for i := len(deletes) - 1; i >= 0; i-- {
+		changes = append(changes, deletes[i]...)
+	}
+	return changes, nil
+}
+
+// resolveReferences replaces the reference fields of the given item with the
+// respective id fields.
+func resolveReferences(c collection, item Object, idx index) (Object, error) {
+	fields := make(Object, len(item))
+	for k, v := range item {
+		fields[k] = v
+	}
+	for _, ref := range c.refs {
+		v, ok := fields[ref.field]
+		if !ok {
+			continue
+		}
+		delete(fields, ref.field)
+
+		if !ref.many {
+			label, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %q must be a name", ref.field)
+			}
+			id, err := idx.lookup(ref.target, label)
+			if err != nil {
+				return nil, fmt.Errorf("resolving field %q: %w", ref.field, err)
+			}
+			fields[ref.idField] = id
+			continue
+		}
+
+		labels, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("field %q must be a list of names", ref.field)
+		}
+		ids := make([]interface{}, len(labels))
+		for i, l := range labels {
+			label, ok := l.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %q must be a list of names", ref.field)
+			}
+			id, err := idx.lookup(ref.target, label)
+			if err != nil {
+				return nil, fmt.Errorf("resolving field %q: %w", ref.field, err)
+			}
+			ids[i] = id
+		}
+		fields[ref.idField] = ids
+	}
+	if c.parent != "" {
+		if _, ok := fields[c.parent]; !ok {
+			return nil, fmt.Errorf("missing field %q", strings.TrimSuffix(c.parent, "_id"))
+		}
+	}
+	return fields, nil
+}
+
+// match finds the current object with the same label (and parent) as the given
+// fields.
+func match(c collection, fields Object, objects map[int]Object) (int, Object, bool) {
+	for _, id := range sortedIDs(objects) {
+		obj := objects[id]
+		if obj[c.labelField] != fields[c.labelField] {
+			continue
+		}
+		if c.parent != "" && !equal(fields[c.parent], obj[c.parent]) {
+			continue
+		}
+		return id, obj, true
+	}
+	return 0, nil, false
+}
+
+// equal compares a desired value with a current value. Lists of ids are
+// compared regardless of their order. Values containing ids of objects that
+// are not created yet are never equal.
+func equal(desired, current interface{}) bool {
+	d, err := normalize(desired)
+	if err != nil {
+		return false
+	}
+	c, err := normalize(current)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(d, c)
+}
+
+func normalize(v interface{}) (interface{}, error) {
+	encV, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var n interface{}
+	if err := json.Unmarshal(encV, &n); err != nil {
+		return nil, err
+	}
+	if l, ok := n.([]interface{}); ok {
+		numbers := make([]float64, 0, len(l))
+		for _, item := range l {
+			f, ok := item.(float64)
+			if !ok {
+				return n, nil
+			}
+			numbers = append(numbers, f)
+		}
+		sort.Float64s(numbers)
+		return numbers, nil
+	}
+	return n, nil
+}
+
+func toID(v interface{}) (int, bool) {
+	switch id := v.(type) {
+	case int:
+		return id, true
+	case float64:
+		return int(id), true
+	}
+	return 0, false
+}
+
+func sortedIDs(objects map[int]Object) []int {
+	ids := make([]int, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Client
+
+type gRPCClient interface {
+	Action(ctx context.Context, in *proto.ActionRequest, opts ...grpc.CallOption) (*proto.ActionResponse, error)
+	Get(ctx context.Context, in *proto.GetRequest, opts ...grpc.CallOption) (*proto.GetResponse, error)
+}
+
+// Run reads the current state via given gRPC client, prints the plan and
+// applies it unless dryRun is true.
+func Run(ctx context.Context, gc gRPCClient, d *Desired, dryRun bool) error {
+	current, err := readState(ctx, gc, d)
+	if err != nil {
+		return fmt.Errorf("reading current state: %w", err)
+	}
+
+	changes, err := Diff(d, current)
+	if err != nil {
+		return fehler.ExitCode(fehler.ExitValidation, fmt.Errorf("computing changes: %w", err))
+	}
+
+	out := output.FromContext(ctx)
+	result := syncResult{DryRun: dryRun, Changes: make([]string, 0, len(changes))}
+
+	if len(changes) == 0 {
+		out.Printf("Nothing to do. The current state matches the desired state.\n")
+		return out.Result(result)
+	}
+
+	for _, c := range changes {
+		switch c.Op {
+		case opCreate:
+			result.Create++
+		case opUpdate:
+			result.Update++
+		case opDelete:
+			result.Delete++
+		}
+		result.Changes = append(result.Changes, c.String())
+	}
+	out.Printf("Plan: %d to create, %d to update, %d to delete.\n", result.Create, result.Update, result.Delete)
+	for _, c := range changes {
+		out.Printf("  %s\n", c)
+	}
+	if dryRun {
+		return out.Result(result)
+	}
+
+	for i, c := range changes {
+		if err := apply(ctx, gc, c); err != nil {
+			err = fmt.Errorf("applying change %d of %d (%s %s %q): %w", i+1, len(changes), c.Op, c.Collection, c.Label, err)
+			if i > 0 {
+				return fehler.ExitCode(fehler.ExitPartialSuccess, err)
+			}
+			return err
+		}
+	}
+	out.Printf("Applied %d changes successfully.\n", len(changes))
+	result.Applied = len(changes)
+	return out.Result(result)
+}
+
+// syncResult is the result of the sync command in JSON output format.
+type syncResult struct {
+	DryRun  bool     `json:"dry_run"`
+	Create  int      `json:"create"`
+	Update  int      `json:"update"`
+	Delete  int      `json:"delete"`
+	Changes []string `json:"changes"`
+	Applied int      `json:"applied"`
+}
+
+// readState reads all objects of all supported collections with the fields
+// that are relevant for the given desired state.
+func readState(ctx context.Context, gc gRPCClient, d *Desired) (State, error) {
+	current := make(State)
+	for _, c := range collections {
+		fieldSet := map[string]bool{"id": true, c.labelField: true}
+		if c.parent != "" {
+			fieldSet[c.parent] = true
+		}
+		for _, item := range d.items(c.name) {
+			for k := range item {
+				if !c.isCreateOnly(k) {
+					fieldSet[k] = true
+				}
+			}
+		}
+		if d.prunes(c.name) {
+			for _, f := range c.protected {
+				fieldSet[f] = true
+			}
+		}
+		for _, ref := range c.refs {
+			if fieldSet[ref.field] {
+				delete(fieldSet, ref.field)
+				fieldSet[ref.idField] = true
+			}
+		}
+		fields := make([]string, 0, len(fieldSet))
+		for f := range fieldSet {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+
+		resp, err := gc.Get(ctx, &proto.GetRequest{Collection: c.name, Fields: fields})
+		if err != nil {
+			return nil, fmt.Errorf("calling manage service (getting collection %s): %w", c.name, fehler.FromGRPC(err))
+		}
+
+		var objects map[string]Object
+		if err := json.Unmarshal([]byte(resp.Value), &objects); err != nil {
+			return nil, fmt.Errorf("unmarshalling collection %s: %w", c.name, err)
+		}
+		current[c.name] = make(map[int]Object, len(objects))
+		for key, obj := range objects {
+			var id int
+			if _, err := fmt.Sscan(key, &id); err != nil {
+				return nil, fmt.Errorf("invalid id %q in collection %s", key, c.name)
+			}
+			current[c.name][id] = obj
+		}
+	}
+	return current, nil
+}
+
+// apply sends the given change to the backend. For created objects the new id
+// is stored so that later changes can use it.
+func apply(ctx context.Context, gc gRPCClient, c Change) error {
+	payload, err := json.Marshal([]Object{c.Payload})
+	if err != nil {
+		return fmt.Errorf("marshalling payload: %w", err)
+	}
+	in := &proto.ActionRequest{
+		Action:  c.Action(),
+		Payload: payload,
+	}
+	resp, err := gc.Action(ctx, in)
+	if err != nil {
+		return fmt.Errorf("calling manage service (calling backend action %q): %w", c.Action(), fehler.FromGRPC(err))
+	}
+
+	out := output.FromContext(ctx)
+	switch c.Op {
+	case opUpdate:
+		out.Printf("Updated %s %q (id %d).\n", c.Collection, c.Label, c.ID)
+		return nil
+	case opDelete:
+		out.Printf("Deleted %s %q (id %d).\n", c.Collection, c.Label, c.ID)
+		return nil
+	}
+
+	var ids []struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(resp.Payload, &ids); err != nil {
+		return fmt.Errorf("unmarshalling action result %q: %w", string(resp.Payload), err)
+	}
+	if len(ids) != 1 {
+		return fmt.Errorf("wrong length of action result, expected 1 item, got %d", len(ids))
+	}
+	c.created.id = ids[0].ID
+	out.Printf("Created %s %q (id %d).\n", c.Collection, c.Label, ids[0].ID)
+	return nil
+}
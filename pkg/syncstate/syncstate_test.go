@@ -0,0 +1,299 @@
+package syncstate_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/syncstate"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"google.golang.org/grpc"
+)
+
+func TestCmd(t *testing.T) {
+	t.Skip("this test does not work because there is no (fake) server running")
+	t.Run("executing syncstate.Cmd()", func(t *testing.T) {
+		// cmd := syncstate.Cmd()
+		// if err := cmd.Execute(); err != nil {
+		// 	t.Fatalf("executing sync subcommand: %v", err)
+		// }
+	})
+}
+
+const desiredYAML = `---
+organization_tags:
+  - name: Berlin
+committees:
+  - name: Board
+    organization_tags: [Berlin]
+  - name: New committee
+meetings:
+  - name: AGM
+    committee: Board
+    description: new description
+  - name: Other meeting
+    committee: New committee
+groups:
+  - name: Delegates
+    meeting: AGM
+prune: [group]
+`
+
+func currentState() syncstate.State {
+	return syncstate.State{
+		"organization_tag": {
+			1: {"id": 1.0, "name": "Berlin"},
+		},
+		"committee": {
+			2: {"id": 2.0, "name": "Board", "organization_tag_ids": []interface{}{1.0}},
+		},
+		"meeting": {
+			3: {"id": 3.0, "name": "AGM", "committee_id": 2.0, "description": "old description"},
+			6: {"id": 6.0, "name": "Unlisted meeting", "committee_id": 2.0},
+		},
+		"group": {
+			4: {"id": 4.0, "name": "Delegates", "meeting_id": 3.0},
+			5: {"id": 5.0, "name": "Staff", "meeting_id": 3.0},
+			7: {"id": 7.0, "name": "Staff", "meeting_id": 6.0},
+			8: {"id": 8.0, "name": "Default", "meeting_id": 3.0, "default_group_for_meeting_id": 3.0},
+			9: {"id": 9.0, "name": "Admin", "meeting_id": 3.0, "admin_group_for_meeting_id": 3.0},
+		},
+		"user": {},
+	}
+}
+
+// Diff tests
+
+func TestDiff(t *testing.T) {
+	d, err := syncstate.ParseDesired([]byte(desiredYAML))
+	if err != nil {
+		t.Fatalf("parsing desired state: %v", err)
+	}
+
+	changes, err := syncstate.Diff(d, currentState())
+	if err != nil {
+		t.Fatalf("computing diff: %v", err)
+	}
+
+	expected := []string{
+		`+ create committee "New committee": {"name":"New committee","organization_id":1}`,
+		`~ update meeting "AGM" (id 3): {"description":"new description","id":3}`,
+		`+ create meeting "Other meeting": {"committee_id":"new:committee:New committee","name":"Other meeting"}`,
+		`- delete group "Staff" (id 5)`,
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("wrong number of changes, expected %d, got %d: %v", len(expected), len(changes), changes)
+	}
+	for i, c := range changes {
+		if c.String() != expected[i] {
+			t.Errorf("wrong change %d, expected %s, got %s", i+1, expected[i], c.String())
+		}
+	}
+}
+
+func TestDiffPruneUsers(t *testing.T) {
+	d, err := syncstate.ParseDesired([]byte("users: [{username: jdoe}]\nprune: [user]"))
+	if err != nil {
+		t.Fatalf("parsing desired state: %v", err)
+	}
+	current := currentState()
+	current["user"] = map[int]syncstate.Object{
+		1: {"id": 1.0, "username": "admin", "organization_management_level": "superadmin"},
+		2: {"id": 2.0, "username": "jdoe"},
+		3: {"id": 3.0, "username": "old"},
+	}
+
+	changes, err := syncstate.Diff(d, current)
+	if err != nil {
+		t.Fatalf("computing diff: %v", err)
+	}
+	expected := `- delete user "old" (id 3)`
+	if len(changes) != 1 || changes[0].String() != expected {
+		t.Fatalf("wrong changes, expected only %s, got %v", expected, changes)
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		desired   string
+		hasErrMsg string
+	}{
+		{"unknown reference", "meetings: [{name: M, committee: Unknown}]", `committee "Unknown" does not exist`},
+		{"missing parent", "groups: [{name: G}]", `missing field "meeting"`},
+		{"duplicate object", "committees: [{name: Board}, {name: Board}]", `"Board" is given more than once`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := syncstate.ParseDesired([]byte(tt.desired))
+			if err != nil {
+				t.Fatalf("parsing desired state: %v", err)
+			}
+			_, err = syncstate.Diff(d, currentState())
+			if err == nil {
+				t.Fatalf("computing diff should fail but it didn't")
+			}
+			if !strings.Contains(err.Error(), tt.hasErrMsg) {
+				t.Fatalf("got error message %q, expected %q", err.Error(), tt.hasErrMsg)
+			}
+		})
+	}
+
+	t.Run("unknown prune collection", func(t *testing.T) {
+		if _, err := syncstate.ParseDesired([]byte("prune: [motion]")); err == nil {
+			t.Fatalf("parsing desired state should fail but it didn't")
+		}
+	})
+}
+
+// Client tests
+
+type mockSyncClient struct {
+	state   syncstate.State
+	actions []*proto.ActionRequest
+}
+
+func (m *mockSyncClient) Get(ctx context.Context, in *proto.GetRequest, opts ...grpc.CallOption) (*proto.GetResponse, error) {
+	objects := make(map[string]syncstate.Object)
+	for id, obj := range m.state[in.Collection] {
+		objects[fmt.Sprint(id)] = obj
+	}
+	encObjects, err := json.Marshal(objects)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling objects: %w", err)
+	}
+	return &proto.GetResponse{Value: string(encObjects)}, nil
+}
+
+func (m *mockSyncClient) Action(ctx context.Context, in *proto.ActionRequest, opts ...grpc.CallOption) (*proto.ActionResponse, error) {
+	m.actions = append(m.actions, in)
+	return &proto.ActionResponse{Payload: []byte(fmt.Sprintf(`[{"id": %d}]`, 100+len(m.actions)))}, nil
+}
+
+func TestRun(t *testing.T) {
+	d, err := syncstate.ParseDesired([]byte(desiredYAML))
+	if err != nil {
+		t.Fatalf("parsing desired state: %v", err)
+	}
+
+	t.Run("dry-run", func(t *testing.T) {
+		mc := &mockSyncClient{state: currentState()}
+		if err := syncstate.Run(context.Background(), mc, d, true); err != nil {
+			t.Fatalf("running syncstate.Run() failed with error: %v", err)
+		}
+		if len(mc.actions) != 0 {
+			t.Fatalf("actions were called in dry-run mode")
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		mc := &mockSyncClient{state: currentState()}
+		if err := syncstate.Run(context.Background(), mc, d, false); err != nil {
+			t.Fatalf("running syncstate.Run() failed with error: %v", err)
+		}
+		if len(mc.actions) != 4 {
+			t.Fatalf("wrong number of actions, expected 4, got %d", len(mc.actions))
+		}
+		// The committee created with the first action gets id 101.
+		expected := `[{"committee_id":101,"name":"Other meeting"}]`
+		if got := string(mc.actions[2].Payload); got != expected {
+			t.Fatalf("wrong payload for meeting.create, expected %s, got %s", expected, got)
+		}
+	})
+}
+
+// mockBackend applies the actions to its state, so a second sync sees the
+// result of the first one.
+type mockBackend struct {
+	state   syncstate.State
+	actions []*proto.ActionRequest
+	nextID  int
+}
+
+func (m *mockBackend) Get(ctx context.Context, in *proto.GetRequest, opts ...grpc.CallOption) (*proto.GetResponse, error) {
+	objects := make(map[string]syncstate.Object)
+	for id, obj := range m.state[in.Collection] {
+		filtered := make(syncstate.Object)
+		for _, f := range in.Fields {
+			if v, ok := obj[f]; ok {
+				filtered[f] = v
+			}
+		}
+		objects[fmt.Sprint(id)] = filtered
+	}
+	encObjects, err := json.Marshal(objects)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling objects: %w", err)
+	}
+	return &proto.GetResponse{Value: string(encObjects)}, nil
+}
+
+func (m *mockBackend) Action(ctx context.Context, in *proto.ActionRequest, opts ...grpc.CallOption) (*proto.ActionResponse, error) {
+	m.actions = append(m.actions, in)
+	var payload []syncstate.Object
+	if err := json.Unmarshal(in.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("unmarshalling payload: %w", err)
+	}
+	obj := payload[0]
+	collection, op, _ := strings.Cut(in.Action, ".")
+
+	switch op {
+	case "create":
+		m.nextID++
+		id := m.nextID
+		obj["id"] = float64(id)
+		if collection == "meeting" {
+			// admin_ids is only a parameter of meeting.create. The backend
+			// creates the default and admin group of the new meeting.
+			delete(obj, "admin_ids")
+			m.state["group"][id+1000] = syncstate.Object{"id": float64(id + 1000), "name": "Default", "meeting_id": float64(id), "default_group_for_meeting_id": float64(id)}
+			m.state["group"][id+2000] = syncstate.Object{"id": float64(id + 2000), "name": "Admin", "meeting_id": float64(id), "admin_group_for_meeting_id": float64(id)}
+		}
+		m.state[collection][id] = obj
+		return &proto.ActionResponse{Payload: []byte(fmt.Sprintf(`[{"id": %d}]`, id))}, nil
+	case "update":
+		id := int(obj["id"].(float64))
+		for k, v := range obj {
+			m.state[collection][id][k] = v
+		}
+	case "delete":
+		delete(m.state[collection], int(obj["id"].(float64)))
+	}
+	return &proto.ActionResponse{}, nil
+}
+
+func TestRunTwice(t *testing.T) {
+	desired := desiredYAML + `
+users:
+  - username: jdoe
+    default_password: secret
+`
+	desired = strings.Replace(desired, "committee: New committee", "committee: New committee\n    admin_ids: [1]", 1)
+	d, err := syncstate.ParseDesired([]byte(desired))
+	if err != nil {
+		t.Fatalf("parsing desired state: %v", err)
+	}
+
+	mc := &mockBackend{state: currentState(), nextID: 100}
+	if err := syncstate.Run(context.Background(), mc, d, false); err != nil {
+		t.Fatalf("running syncstate.Run() failed with error: %v", err)
+	}
+	var created bool
+	for _, a := range mc.actions {
+		if a.Action == "meeting.create" && strings.Contains(string(a.Payload), `"admin_ids":[1]`) {
+			created = true
+		}
+	}
+	if !created {
+		t.Fatalf("first run did not create the meeting with admin_ids")
+	}
+
+	mc.actions = nil
+	if err := syncstate.Run(context.Background(), mc, d, false); err != nil {
+		t.Fatalf("running syncstate.Run() the second time failed with error: %v", err)
+	}
+	if len(mc.actions) != 0 {
+		t.Fatalf("second run should not change anything, got %d actions, first: %s %s", len(mc.actions), mc.actions[0].Action, mc.actions[0].Payload)
+	}
+}
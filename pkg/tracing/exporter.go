@@ -0,0 +1,238 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileExporter writes every span as JSON line to a file. It is meant for
+// local testing.
+type FileExporter struct {
+	mu      sync.Mutex
+	f       *os.File
+	onError func(error)
+}
+
+// NewFileExporter opens the given file for appending. The function onError is
+// called if a span can not be written.
+func NewFileExporter(filename string, onError func(error)) (*FileExporter, error) {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening trace file: %w", err)
+	}
+	return &FileExporter{f: f, onError: onError}, nil
+}
+
+// Export writes the span to the file.
+func (e *FileExporter) Export(s *Span) {
+	line, err := json.Marshal(s)
+	if err != nil {
+		e.onError(fmt.Errorf("marshalling span: %w", err))
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.f.Write(append(line, '\n')); err != nil {
+		e.onError(fmt.Errorf("writing span: %w", err))
+	}
+}
+
+// Close closes the file.
+func (e *FileExporter) Close() error {
+	return e.f.Close()
+}
+
+const (
+	// otlpServiceName is the service.name resource attribute of all spans.
+	otlpServiceName = "openslides-manage"
+
+	// otlpFlushInterval is the time after which collected spans are sent.
+	otlpFlushInterval = 5 * time.Second
+
+	// otlpMaxBatch is the number of spans after which they are sent
+	// immediately.
+	otlpMaxBatch = 512
+
+	otlpTimeout = 10 * time.Second
+)
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector via
+// OTLP/HTTP with JSON encoding.
+type OTLPExporter struct {
+	url     string
+	onError func(error)
+
+	mu    sync.Mutex
+	spans []*Span
+
+	flush chan struct{}
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewOTLPExporter returns an exporter for the given collector endpoint like
+// http://otel-collector:4318. The path /v1/traces is appended. The function
+// onError is called if spans can not be sent.
+func NewOTLPExporter(endpoint string, onError func(error)) *OTLPExporter {
+	e := &OTLPExporter{
+		url:     strings.TrimRight(endpoint, "/") + "/v1/traces",
+		onError: onError,
+		flush:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.loop()
+	return e
+}
+
+// Export adds the span to the next batch.
+func (e *OTLPExporter) Export(s *Span) {
+	e.mu.Lock()
+	e.spans = append(e.spans, s)
+	full := len(e.spans) >= otlpMaxBatch
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close sends the remaining spans and stops the exporter.
+func (e *OTLPExporter) Close() error {
+	close(e.done)
+	e.wg.Wait()
+	return nil
+}
+
+func (e *OTLPExporter) loop() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.done:
+			e.send()
+			return
+		}
+		e.send()
+	}
+}
+
+func (e *OTLPExporter) send() {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+	if err := e.post(spans); err != nil {
+		e.onError(fmt.Errorf("sending %d spans to %s: %w", len(spans), e.url, err))
+	}
+}
+
+func (e *OTLPExporter) post(spans []*Span) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return fmt.Errorf("marshalling request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("got response %q: %s", resp.Status, respBody)
+	}
+	return nil
+}
+
+// otlpRequest builds the OTLP/JSON request body for the given spans, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+func otlpRequest(spans []*Span) map[string]interface{} {
+	encSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		status := map[string]interface{}{"code": 1} // OK
+		if s.Error != "" {
+			status = map[string]interface{}{"code": 2, "message": s.Error} // Error
+		}
+		encSpans = append(encSpans, map[string]interface{}{
+			"traceId":           s.TraceID,
+			"spanId":            s.SpanID,
+			"parentSpanId":      s.ParentSpanID,
+			"name":              s.Name,
+			"kind":              int(s.Kind),
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+			"status":            status,
+		})
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": otlpServiceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": otlpServiceName},
+						"spans": encSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	encAttrs := make([]interface{}, 0, len(attrs))
+	for _, k := range keys {
+		var value map[string]interface{}
+		switch v := attrs[k].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encAttrs = append(encAttrs, map[string]interface{}{"key": k, "value": value})
+	}
+	return encAttrs
+}
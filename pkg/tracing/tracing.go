@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the header of the W3C trace context.
+const TraceparentHeader = "traceparent"
+
+// Kind is the kind of a span like in OpenTelemetry.
+type Kind int
+
+const (
+	// KindInternal is a span for an operation inside of the service.
+	KindInternal Kind = 1
+
+	// KindServer is a span for an incoming request.
+	KindServer Kind = 2
+
+	// KindClient is a span for an outgoing request.
+	KindClient Kind = 3
+)
+
+// Exporter sends finished spans to a tracing backend.
+type Exporter interface {
+	Export(s *Span)
+}
+
+var global = struct {
+	mu       sync.RWMutex
+	exporter Exporter
+}{}
+
+// SetExporter sets the exporter for all spans of the process. Tracing is
+// disabled if it is nil. Trace context is propagated in any case.
+func SetExporter(e Exporter) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	global.exporter = e
+}
+
+func exporter() Exporter {
+	global.mu.RLock()
+	defer global.mu.RUnlock()
+	return global.exporter
+}
+
+// Span is a timed operation that is part of a trace.
+type Span struct {
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         Kind                   `json:"kind"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+type contextKey int
+
+const spanKey contextKey = iota
+
+// Start starts a new span. It is a child of the span in the given context if
+// there is one. The returned context contains the new span. The span has to be
+// finished with Finish.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	s := &Span{
+		SpanID:     randomHex(8),
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+	}
+	if parent := FromContext(ctx); parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentSpanID = parent.SpanID
+	} else {
+		s.TraceID = randomHex(16)
+	}
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// FromContext returns the current span of the context or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// TraceID returns the trace id of the current span of the context or an empty
+// string.
+func TraceID(ctx context.Context) string {
+	if s := FromContext(ctx); s != nil {
+		return s.TraceID
+	}
+	return ""
+}
+
+// SetAttribute adds a key value pair to the span. Values should be strings,
+// integers or booleans.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.Attributes[key] = value
+}
+
+// Finish ends the span and exports it. A non nil error marks the span as
+// failed.
+func (s *Span) Finish(err error) {
+	s.End = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if e := exporter(); e != nil {
+		e.Export(s)
+	}
+}
+
+// Extract returns a new context with the remote parent given in the W3C
+// traceparent value. The context is returned unchanged if the value is
+// invalid.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	// Example: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || parts[0] != "00" || !isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+		return ctx
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return ctx
+	}
+	s := &Span{TraceID: parts[1], SpanID: parts[2]}
+	return context.WithValue(ctx, spanKey, s)
+}
+
+// Traceparent returns the W3C traceparent value for the current span of the
+// context or an empty string.
+func Traceparent(ctx context.Context) string {
+	s := FromContext(ctx)
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+}
+
+// Inject sets the traceparent header for the current span of the context.
+func Inject(ctx context.Context, h http.Header) {
+	if tp := Traceparent(ctx); tp != "" {
+		h.Set(TraceparentHeader, tp)
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// Ids have to be non zero, so use the time as fallback.
+		copy(b, fmt.Sprintf("%0*x", n, time.Now().UnixNano()))
+	}
+	return hex.EncodeToString(b)
+}
+
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
@@ -0,0 +1,141 @@
+package tracing_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/tracing"
+)
+
+func TestPropagation(t *testing.T) {
+	t.Run("extract and inject", func(t *testing.T) {
+		tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		ctx := tracing.Extract(context.Background(), tp)
+		ctx, span := tracing.Start(ctx, "test", tracing.KindClient)
+
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Fatalf("wrong trace id, got %q", span.TraceID)
+		}
+		if span.ParentSpanID != "00f067aa0ba902b7" {
+			t.Fatalf("wrong parent span id, got %q", span.ParentSpanID)
+		}
+
+		h := make(http.Header)
+		tracing.Inject(ctx, h)
+		expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanID + "-01"
+		if got := h.Get("traceparent"); got != expected {
+			t.Fatalf("wrong traceparent header, expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("invalid traceparent", func(t *testing.T) {
+		for _, tp := range []string{
+			"",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		} {
+			ctx := tracing.Extract(context.Background(), tp)
+			if tracing.FromContext(ctx) != nil {
+				t.Errorf("traceparent %q should be ignored", tp)
+			}
+		}
+	})
+
+	t.Run("new trace", func(t *testing.T) {
+		ctx, parent := tracing.Start(context.Background(), "parent", tracing.KindServer)
+		_, child := tracing.Start(ctx, "child", tracing.KindClient)
+		if len(parent.TraceID) != 32 || parent.ParentSpanID != "" {
+			t.Fatalf("wrong root span: %+v", parent)
+		}
+		if child.TraceID != parent.TraceID || child.ParentSpanID != parent.SpanID {
+			t.Fatalf("child is not part of the trace: %+v", child)
+		}
+		if tracing.TraceID(ctx) != parent.TraceID {
+			t.Fatalf("wrong trace id in context, got %q", tracing.TraceID(ctx))
+		}
+	})
+}
+
+func TestFileExporter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "traces.jsonl")
+	e, err := tracing.NewFileExporter(filename, func(err error) { t.Errorf("exporting: %v", err) })
+	if err != nil {
+		t.Fatalf("creating exporter: %v", err)
+	}
+	tracing.SetExporter(e)
+	defer tracing.SetExporter(nil)
+
+	_, span := tracing.Start(context.Background(), "test", tracing.KindServer)
+	span.SetAttribute("rpc.method", "/Manage/Get")
+	span.Finish(errors.New("some error"))
+	if err := e.Close(); err != nil {
+		t.Fatalf("closing exporter: %v", err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("opening trace file: %v", err)
+	}
+	defer f.Close()
+	var got []tracing.Span
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var span tracing.Span
+		if err := json.Unmarshal(s.Bytes(), &span); err != nil {
+			t.Fatalf("decoding span: %v", err)
+		}
+		got = append(got, span)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(got))
+	}
+	if got[0].Name != "test" || got[0].Error != "some error" || got[0].Attributes["rpc.method"] != "/Manage/Get" {
+		t.Fatalf("wrong span: %+v", got[0])
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("wrong path %q", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer ts.Close()
+
+	e := tracing.NewOTLPExporter(ts.URL, func(err error) { t.Errorf("exporting: %v", err) })
+	tracing.SetExporter(e)
+	defer tracing.SetExporter(nil)
+
+	_, span := tracing.Start(context.Background(), "Manage/Version", tracing.KindServer)
+	span.SetAttribute("rpc.grpc.status_code", 0)
+	span.Finish(nil)
+	if err := e.Close(); err != nil {
+		t.Fatalf("closing exporter: %v", err)
+	}
+
+	body := <-received
+	for _, expected := range []string{
+		`"traceId":"` + span.TraceID + `"`,
+		`"name":"Manage/Version"`,
+		`"kind":2`,
+		`{"key":"rpc.grpc.status_code","value":{"intValue":"0"}}`,
+		`{"key":"service.name","value":{"stringValue":"openslides-manage"}}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("request body does not contain %s, got %s", expected, body)
+		}
+	}
+}
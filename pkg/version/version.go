@@ -9,10 +9,13 @@ import (
 	"strings"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/output"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/pkg/tracing"
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/status"
 )
 
 const (
@@ -33,12 +36,19 @@ func Cmd() *cobra.Command {
 		Args:  cobra.NoArgs,
 	}
 	cp := connection.Unary(cmd)
+	fl := connection.Multi(cmd, cp)
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
+		if fl.Enabled() {
+			return fl.Run(cmd, func(ctx context.Context, cl proto.ManageClient, _ connection.Params) error {
+				return Run(ctx, cl)
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := cp.Dial(ctx)
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -64,37 +74,47 @@ func Run(ctx context.Context, gc gRPCClient) error {
 
 	resp, err := gc.Version(ctx, in)
 	if err != nil {
-		s, _ := status.FromError(err) // The ok value does not matter here.
-		return fmt.Errorf("calling manage service (retrieving version): %s", s.Message())
+		return fmt.Errorf("calling manage service (retrieving version): %w", fehler.FromGRPC(err))
 	}
 
-	fmt.Println(strings.TrimSpace(resp.Version))
-	return nil
+	v := strings.TrimSpace(resp.Version)
+	p := output.FromContext(ctx)
+	p.Printf("%s\n", v)
+	return p.Result(map[string]string{"version": v})
 }
 
 // Server
 
 // Version retrieves the version tag from the client container.
 // This function is the server side entrypoint for this package.
-func Version(ctx context.Context, in *proto.VersionRequest, clientVersionURL *url.URL) (*proto.VersionResponse, error) {
+func Version(ctx context.Context, in *proto.VersionRequest, clientVersionURL *url.URL) (_ *proto.VersionResponse, err error) {
 	addr := clientVersionURL.String()
+
+	ctx, span := tracing.Start(ctx, "HTTP GET", tracing.KindClient)
+	span.SetAttribute("http.method", "GET")
+	span.SetAttribute("http.url", addr)
+	defer func() { span.Finish(err) }()
+
 	req, err := http.NewRequestWithContext(ctx, "GET", addr, nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating request to client service: %w", err)
 	}
+	tracing.Inject(ctx, req.Header)
+	shared.InjectRequestID(ctx, req.Header)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("sending request to client service at %q: %w", addr, err)
 	}
 	defer resp.Body.Close()
+	span.SetAttribute("http.status_code", resp.StatusCode)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			body = []byte("[can not read body]")
 		}
-		return nil, fmt.Errorf("got response %q: %q", resp.Status, body)
+		return nil, fehler.WithCode(fehler.CodeFromHTTP(resp.StatusCode), fmt.Errorf("got response %q: %q", resp.Status, body))
 	}
 
 	encodedResp, err := io.ReadAll(resp.Body)